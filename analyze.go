@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"k8s.io/client-go/kubernetes"
+
+	mvUtil "movePod/util"
+)
+
+// print the verdicts as a table, one line per pod
+func printMovability(result []*mvUtil.Movability) {
+	if outputFormat == outputJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			glog.Errorf("failed to encode analysis: %v", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tPOD\tNODE\tPARENT\tMOVABLE\tREASONS")
+	movable := 0
+	for _, m := range result {
+		parent := "<none>"
+		if m.ParentKind != "" {
+			parent = fmt.Sprintf("%v/%v", m.ParentKind, m.ParentName)
+		}
+
+		reasons := make([]string, 0, len(m.Reasons))
+		for _, r := range m.Reasons {
+			reasons = append(reasons, fmt.Sprintf("%v: %v", r.Reason, r.Message))
+		}
+		if m.Movable {
+			movable++
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", m.NameSpace, m.Pod, m.Node, parent, m.Movable, strings.Join(reasons, "; "))
+	}
+	w.Flush()
+	fmt.Printf("\n%d of %d pods are movable\n", movable, len(result))
+}
+
+// classify the pods of the namespace, or of all the namespaces, as movable or not
+func runAnalyze(kubeClient *kubernetes.Clientset) int {
+	ns := nameSpace
+	if allNameSpaces {
+		ns = ""
+	}
+
+	result, err := mvUtil.NewPodAnalyzer(kubeClient).AnalyzeNameSpace(ns)
+	if err != nil {
+		glog.Errorf("failed to list pods of namespace [%v]: %v", ns, err)
+		return exitGetPodFailed
+	}
+
+	printMovability(result)
+	return exitOK
+}
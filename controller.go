@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"movePod/metrics"
+	mvUtil "movePod/util"
+)
+
+// a move is requested by annotating the pod with the destination node;
+// the outcome is written back into the status annotations.
+const (
+	annotationTargetNode   = "movepod/target-node"
+	annotationStatus       = "movepod/status"
+	annotationStatusTarget = "movepod/status-target"
+	annotationMessage      = "movepod/message"
+
+	controllerMaxRetries = 3
+	controllerResync     = time.Minute * 5
+)
+
+// annotationController watches the pods, and moves the pods annotated with annotationTargetNode.
+type annotationController struct {
+	client   *kubernetes.Clientset
+	store    cache.Store
+	informer cache.Controller
+
+	// keys of the pods to be moved; the queue de-duplicates the requests of the same pod
+	queue workqueue.RateLimitingInterface
+
+	// closed when the controller stops, e.g. the leadership is lost
+	stop <-chan struct{}
+}
+
+func newAnnotationController(client *kubernetes.Clientset, nameSpace string) *annotationController {
+	c := &annotationController{
+		client: client,
+		queue:  workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+
+	lw := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "pods", nameSpace, fields.Everything())
+	c.store, c.informer = cache.NewInformer(lw, &v1.Pod{}, controllerResync,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: c.enqueue,
+			UpdateFunc: func(old, cur interface{}) {
+				c.enqueue(cur)
+			},
+		})
+
+	return c
+}
+
+// whether the pod has a move request which is not handled yet
+func needMove(pod *v1.Pod) bool {
+	if pod.Annotations == nil || pod.DeletionTimestamp != nil {
+		return false
+	}
+
+	target := pod.Annotations[annotationTargetNode]
+	if target == "" {
+		return false
+	}
+
+	status := pod.Annotations[annotationStatus]
+	if pod.Annotations[annotationStatusTarget] == target &&
+		(status == mvUtil.StatusSucceeded || status == mvUtil.StatusFailed) {
+		return false
+	}
+
+	return true
+}
+
+func (c *annotationController) enqueue(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || !needMove(pod) {
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("failed to get key of pod: %v", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// process the move requests until stop is closed; stop also cancels the in-flight moves which have not deleted their pods yet.
+func (c *annotationController) Run(workers int, stop <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	c.stop = stop
+
+	go c.informer.Run(stop)
+	if !cache.WaitForCacheSync(stop, c.informer.HasSynced) {
+		glog.Errorf("failed to sync the pod cache")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.worker(stop)
+		}()
+	}
+
+	<-stop
+	//stop taking new items, and wait for the in-flight ones
+	c.queue.ShutDown()
+	wg.Wait()
+}
+
+func (c *annotationController) worker(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if !c.processNextItem() {
+			return
+		}
+	}
+}
+
+func (c *annotationController) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.sync(key.(string))
+	if err == nil {
+		c.queue.Forget(key)
+		return true
+	}
+
+	if isRetriable(err) && c.queue.NumRequeues(key) < controllerMaxRetries {
+		glog.Warningf("move of pod %v failed, will retry: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	glog.Errorf("move of pod %v failed: %v", key, err)
+	c.queue.Forget(key)
+	return true
+}
+
+// errors which may succeed by trying again; the pod is not deleted yet when these happen.
+func isRetriable(err error) bool {
+	switch mvUtil.ReasonForError(err) {
+	case mvUtil.ReasonUnknown,
+		mvUtil.ReasonGetPodFailed,
+		mvUtil.ReasonSchedulerUpdateFailed,
+		mvUtil.ReasonBackupFailed,
+		mvUtil.ReasonDeleteFailed,
+		mvUtil.ReasonOrphanFailed,
+		mvUtil.ReasonRolloutInProgress:
+		return true
+	}
+	return false
+}
+
+func (c *annotationController) sync(key string) error {
+	_, exists, err := c.store.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		glog.V(3).Infof("pod %v does not exist anymore", key)
+		return nil
+	}
+
+	//the cache may be stale during a move, so get the latest pod.
+	nameSpace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pod, err := c.client.CoreV1().Pods(nameSpace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if !needMove(pod) {
+		return nil
+	}
+
+	target := pod.Annotations[annotationTargetNode]
+	if pod.Spec.NodeName == target {
+		return c.updateStatus(pod.Namespace, pod.Name, target, mvUtil.StatusSucceeded,
+			fmt.Sprintf("pod is on node %v", target))
+	}
+
+	if err := c.updateStatus(pod.Namespace, pod.Name, target, mvUtil.StatusRunning, ""); err != nil {
+		return err
+	}
+
+	trace := mvUtil.NewMoveTrace(key, target)
+	opts := buildMoveOptions(trace)
+	opts.Cancel = c.stop
+	err = moveAndCheck(c.client, pod.Namespace, pod.Name, target, opts)
+	trace.Finish(err)
+
+	result := trace.Result()
+	metrics.ObserveMove(&result)
+
+	if err == nil {
+		c.writeOutcome(pod, result.NewPod, target, mvUtil.StatusSucceeded,
+			fmt.Sprintf("moved from node %v to node %v", result.SourceNode, target))
+		return nil
+	}
+
+	//a move cancelled by the loss of the leadership is left to the next leader
+	status := mvUtil.StatusFailed
+	if isRetriable(err) && c.queue.NumRequeues(key) < controllerMaxRetries ||
+		mvUtil.ReasonForError(err) == mvUtil.ReasonCancelled {
+		status = mvUtil.StatusRunning
+	}
+	c.writeOutcome(pod, result.NewPod, target, status, err.Error())
+	return err
+}
+
+// write the outcome into the original pod, and into the new pod if it has another name,
+// as the orphan and scale strategies replace the pod by one with a generated name, and the original may be gone.
+// A failed write is logged only, as the move is not retried for it.
+func (c *annotationController) writeOutcome(pod *v1.Pod, newPod, target, status, message string) {
+	names := []string{pod.Name}
+	if newPod != "" && newPod != pod.Name {
+		names = append(names, newPod)
+	}
+
+	for _, name := range names {
+		err := c.updateStatus(pod.Namespace, name, target, status, message)
+		if err == nil || name == pod.Name && newPod != "" && errors.IsNotFound(err) {
+			continue
+		}
+		glog.Errorf("the outcome of moving pod %v/%v is not recorded on pod %v: %v [%v]", pod.Namespace, pod.Name, name, status, message)
+	}
+}
+
+// write the move status into the annotations of the pod
+func (c *annotationController) updateStatus(nameSpace, name, target, status, message string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				annotationStatus:       status,
+				annotationStatusTarget: target,
+				annotationMessage:      message,
+			},
+		},
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.client.CoreV1().Pods(nameSpace).Patch(name, types.StrategicMergePatchType, data)
+	return err
+}
+
+// run in controller mode: watch the pods in nameSpace (all namespaces if empty) for move requests.
+func runController(kubeClient *kubernetes.Clientset) int {
+	startMetricsServer()
+
+	return runLeaderElected(kubeClient, func(stop <-chan struct{}) {
+		glog.V(2).Infof("watching pods annotated with %v in namespace [%v]", annotationTargetNode, watchNameSpace)
+		c := newAnnotationController(kubeClient, watchNameSpace)
+		c.Run(serverWorkers, stop)
+	})
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+
+	mvUtil "movePod/util"
+)
+
+// the change of the parent's scheduler that the move would make
+type schedulerChange struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Accessor string `json:"accessor"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+}
+
+// what a move would do, without changing anything
+type movePlan struct {
+	Pod             string              `json:"pod"`
+	SourceNode      string              `json:"sourceNode"`
+	DestinationNode string              `json:"destinationNode"`
+	ParentKind      string              `json:"parentKind,omitempty"`
+	ParentName      string              `json:"parentName,omitempty"`
+	Strategy        string              `json:"strategy"`
+	SchedulerChange *schedulerChange    `json:"schedulerChange,omitempty"`
+	GracePeriod     *mvUtil.GracePeriod `json:"gracePeriod,omitempty"`
+	PendingPods     []string            `json:"pendingPodsToDelete"`
+	Permissions     []string            `json:"missingPermissions"`
+	Problems        []string            `json:"problems"`
+	PodCopy         *v1.Pod             `json:"podCopy,omitempty"`
+	Replacement     string              `json:"replacement,omitempty"`
+	Diff            []mvUtil.FieldDiff  `json:"diff"`
+	Warnings        []string            `json:"warnings"`
+
+	// reason of the first problem, which the real move would fail with
+	reason mvUtil.ErrorReason
+}
+
+func (p *movePlan) addProblem(err error) {
+	if p.reason == "" {
+		p.reason = mvUtil.ReasonForError(err)
+	}
+	p.Problems = append(p.Problems, err.Error())
+}
+
+// resolve everything the move needs, and report what it would do.
+func planMove(client *kubernetes.Clientset, nameSpace, podName, nodeName string) *movePlan {
+	plan := &movePlan{
+		Pod:             fmt.Sprintf("%v/%v", nameSpace, podName),
+		DestinationNode: nodeName,
+		PendingPods:     []string{},
+		Permissions:     []string{},
+		Problems:        []string{},
+		Diff:            []mvUtil.FieldDiff{},
+		Warnings:        []string{},
+	}
+
+	pod, err := client.CoreV1().Pods(nameSpace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		plan.addProblem(mvUtil.NewMoveError(mvUtil.ReasonGetPodFailed, "failed to get pod %v: %v", plan.Pod, err))
+		return plan
+	}
+	plan.SourceNode = pod.Spec.NodeName
+	if pod.Spec.NodeName == nodeName {
+		plan.addProblem(mvUtil.NewMoveError(mvUtil.ReasonAlreadyOnNode, "pod %v is already on node: %v", plan.Pod, nodeName))
+	}
+
+	parentKind, parentName, err := mvUtil.ParseParentInfo(pod)
+	if err != nil {
+		plan.addProblem(mvUtil.NewMoveError(mvUtil.ReasonInvalidParent, "cannot get parent info: %v", err))
+		return plan
+	}
+	plan.ParentKind = parentKind
+	plan.ParentName = parentName
+
+	plan.Strategy = mvUtil.StrategyDirect
+	if parentKind != "" {
+		plan.Strategy = mvUtil.StrategySchedulerSwap
+		if moveStrategy != "" {
+			plan.Strategy = moveStrategy
+		}
+	}
+	if plan.Strategy == mvUtil.StrategyScale {
+		if err := mvUtil.CheckScaleParent(client, nameSpace, parentKind, parentName); err != nil {
+			plan.addProblem(err)
+		}
+	}
+	if plan.Strategy != mvUtil.StrategyDirect {
+		planSchedulerSwap(client, pod, plan)
+	}
+
+	plan.GracePeriod = mvUtil.CalcGracePeriod(pod, gracePolicy)
+	if plan.GracePeriod.Capped {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("grace period of the pod is capped: %v", plan.GracePeriod))
+	}
+	if plan.GracePeriod.Force {
+		plan.Warnings = append(plan.Warnings, "the pod is force deleted: its containers may still be running when the copy starts")
+	}
+
+	if parentKind == "ReplicaSet" && rolloutCheck != rolloutIgnore {
+		if _, err := mvUtil.CheckRollout(client, nameSpace, parentName); err != nil {
+			plan.addProblem(rolloutError(err))
+		}
+	}
+
+	req := &mvUtil.PermissionRequest{NameSpace: nameSpace, ParentKind: parentKind, Strategy: plan.Strategy,
+		CheckRollout: rolloutCheck != rolloutIgnore, PauseDeployment: pauseDeployment, HighVersion: isHighVersion()}
+	missing, err := mvUtil.CheckPermissions(client, mvUtil.MovePermissions(req), req.HighVersion)
+	if err != nil {
+		plan.addProblem(mvUtil.NewMoveError(mvUtil.ReasonPermissionDenied, "%v", err))
+	}
+	for _, perm := range missing {
+		plan.Permissions = append(plan.Permissions, perm.String())
+	}
+	if len(missing) > 0 {
+		plan.addProblem(mvUtil.NewMoveError(mvUtil.ReasonPermissionDenied, "missing %d permissions", len(missing)))
+	}
+
+	//the orphan strategy creates no copy: the parent creates the replacement from its template
+	if plan.Strategy == mvUtil.StrategyOrphan {
+		plan.Replacement = fmt.Sprintf("replacement from template of %v %v", parentKind, parentName)
+		return plan
+	}
+
+	plan.PodCopy, err = mvUtil.ClonePodForMove(pod, nodeName, buildSanitizePolicy())
+	if err != nil {
+		plan.addProblem(fmt.Errorf("failed to copy pod: %v", err))
+		return plan
+	}
+	if err := podMutation.Apply(plan.PodCopy); err != nil {
+		plan.addProblem(fmt.Errorf("failed to mutate the pod copy: %v", err))
+	}
+	diff, err := mvUtil.DiffPod(pod, plan.PodCopy)
+	if err != nil {
+		glog.Warningf("failed to diff pod %v and its copy: %v", plan.Pod, err)
+	} else {
+		plan.Diff = diff
+	}
+	plan.Warnings = append(plan.Warnings, mvUtil.RiskyFields(pod, plan.PodCopy)...)
+	return plan
+}
+
+func planSchedulerSwap(client *kubernetes.Clientset, pod *v1.Pod, plan *movePlan) {
+	highver := isHighVersion()
+	helper, err := mvUtil.NewMoveHelper(client, pod.Namespace, pod.Name, plan.ParentKind, plan.ParentName, noexistSchedulerName, highver)
+	if err != nil {
+		plan.addProblem(err)
+		return
+	}
+
+	current, err := helper.GetCurrentScheduler()
+	if err != nil {
+		plan.addProblem(mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed, "failed to get scheduler of %v %v/%v: %v",
+			plan.ParentKind, pod.Namespace, plan.ParentName, err))
+		return
+	}
+	plan.SchedulerChange = &schedulerChange{
+		Kind:     plan.ParentKind,
+		Name:     plan.ParentName,
+		Accessor: mvUtil.SchedulerAccessor(highver),
+		From:     current,
+		To:       noexistSchedulerName,
+	}
+	//the move refuses a parent whose scheduler is swapped by another move, as it could not restore it
+	if current == noexistSchedulerName {
+		plan.addProblem(mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed, "%v %v/%v is being used by another move: its scheduler is already [%v]",
+			plan.ParentKind, pod.Namespace, plan.ParentName, noexistSchedulerName))
+	}
+
+	pods, err := mvUtil.ListPendingPod(client, pod.Namespace, noexistSchedulerName, plan.ParentKind, plan.ParentName, highver)
+	if err != nil {
+		glog.Warningf("failed to list pending pods: %v", err)
+		return
+	}
+	for _, p := range pods {
+		plan.PendingPods = append(plan.PendingPods, p.Name)
+	}
+}
+
+func printPlan(plan *movePlan) {
+	if outputFormat == outputJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			glog.Errorf("failed to encode plan: %v", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Pod:              %v\n", plan.Pod)
+	fmt.Printf("Move:             %v -> %v\n", plan.SourceNode, plan.DestinationNode)
+	if plan.ParentKind != "" {
+		fmt.Printf("Parent:           %v %v\n", plan.ParentKind, plan.ParentName)
+	} else {
+		fmt.Printf("Parent:           <none>\n")
+	}
+	fmt.Printf("Strategy:         %v\n", plan.Strategy)
+	if plan.GracePeriod != nil {
+		fmt.Printf("Grace period:     %v\n", plan.GracePeriod)
+	}
+	if c := plan.SchedulerChange; c != nil {
+		fmt.Printf("Scheduler change: %v %v: [%v] -> [%v], by %v\n", c.Kind, c.Name, c.From, c.To, c.Accessor)
+		fmt.Printf("Pending pods to delete afterwards: [%v]\n", strings.Join(plan.PendingPods, ", "))
+	}
+	for _, perm := range plan.Permissions {
+		fmt.Printf("Missing permission: %v\n", perm)
+	}
+	for _, problem := range plan.Problems {
+		fmt.Printf("Problem: %v\n", problem)
+	}
+
+	if len(plan.Diff) > 0 {
+		fmt.Printf("Changes of the copy:\n")
+		for _, d := range plan.Diff {
+			fmt.Printf("  %v\n", d)
+		}
+	}
+	for _, w := range plan.Warnings {
+		fmt.Printf("Warning: %v\n", w)
+	}
+
+	if plan.Replacement != "" {
+		fmt.Printf("Pod to be created: %v\n", plan.Replacement)
+	}
+	if plan.PodCopy != nil {
+		data, err := json.MarshalIndent(plan.PodCopy, "", "  ")
+		if err != nil {
+			glog.Errorf("failed to encode pod copy: %v", err)
+			return
+		}
+		fmt.Printf("Pod to be created:\n%v\n", string(data))
+	}
+}
+
+// show what the move would do, without changing anything
+func runDryRun(kubeClient *kubernetes.Clientset) int {
+	plan := planMove(kubeClient, nameSpace, podName, nodeName)
+	printPlan(plan)
+
+	if plan.reason == "" {
+		return exitOK
+	}
+	return exitCodeForError(mvUtil.NewMoveError(plan.reason, ""))
+}
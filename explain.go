@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+
+	mvUtil "movePod/util"
+)
+
+// how long the copy is assumed to take to be running, if the original pod gives no hint
+const defaultStartupEstimate = time.Second * 5
+
+// what movePod would do, step by step, and why
+type explanation struct {
+	Pod               string                   `json:"pod"`
+	SourceNode        string                   `json:"sourceNode"`
+	DestinationNode   string                   `json:"destinationNode"`
+	Parent            *mvUtil.OwnerInfo        `json:"parent,omitempty"`
+	OwnerChain        []mvUtil.OwnerInfo       `json:"ownerChain"`
+	Strategy          string                   `json:"strategy"`
+	SchedulerAccessor string                   `json:"schedulerAccessor,omitempty"`
+	CurrentScheduler  string                   `json:"currentScheduler,omitempty"`
+	GracePeriod       *mvUtil.GracePeriod      `json:"gracePeriod"`
+	Predicates        []mvUtil.PredicateResult `json:"predicates"`
+	Unmovable         []mvUtil.UnmovableReason `json:"unmovable"`
+	Downtime          string                   `json:"estimatedDowntime"`
+	DowntimeReason    string                   `json:"estimatedDowntimeReason"`
+	Steps             []string                 `json:"steps"`
+	Verdict           bool                     `json:"movable"`
+}
+
+func (e *explanation) addStep(format string, a ...interface{}) {
+	e.Steps = append(e.Steps, fmt.Sprintf(format, a...))
+}
+
+// how long the original pod took from being started to be ready
+func podStartupTime(pod *v1.Pod) (time.Duration, bool) {
+	if pod.Status.StartTime == nil {
+		return 0, false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady && c.Status == v1.ConditionTrue {
+			d := c.LastTransitionTime.Time.Sub(pod.Status.StartTime.Time)
+			//the pod may have been ready again long after a restart
+			if d >= 0 && d < time.Minute*10 {
+				return d, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// estimate the time the pod is not running: the original is deleted before the copy is created,
+// except by the orphan and scale strategies.
+func estimateDowntime(pod *v1.Pod, strategy string, grace *mvUtil.GracePeriod) (time.Duration, string) {
+	if strategy == mvUtil.StrategyOrphan || strategy == mvUtil.StrategyScale {
+		return 0, "the original pod is deleted after its replacement is running"
+	}
+
+	startup, ok := podStartupTime(pod)
+	hint := fmt.Sprintf("%v for the copy to be ready, as the original pod took", startup)
+	if !ok {
+		startup = defaultStartupEstimate
+		hint = fmt.Sprintf("%v assumed for the copy to be ready", startup)
+	}
+
+	terminate := time.Duration(grace.Seconds+1) * time.Second
+	return terminate + startup, fmt.Sprintf("at most %v for the original pod to terminate, plus %v", terminate, hint)
+}
+
+// explain what the move of the pod to the node would do, without changing anything
+func explainMove(client *kubernetes.Clientset, nameSpace, podName, nodeName string) (*explanation, error) {
+	e := &explanation{
+		Pod:             fmt.Sprintf("%v/%v", nameSpace, podName),
+		DestinationNode: nodeName,
+		OwnerChain:      []mvUtil.OwnerInfo{},
+		Predicates:      []mvUtil.PredicateResult{},
+		Unmovable:       []mvUtil.UnmovableReason{},
+		Steps:           []string{},
+	}
+
+	pod, err := client.CoreV1().Pods(nameSpace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, mvUtil.NewMoveError(mvUtil.ReasonGetPodFailed, "failed to get pod %v: %v", e.Pod, err)
+	}
+	e.SourceNode = pod.Spec.NodeName
+	e.addStep("get pod %v on node %v", e.Pod, pod.Spec.NodeName)
+
+	//1. parent
+	e.Parent, err = mvUtil.ParsePodOwner(pod)
+	if err != nil {
+		return nil, mvUtil.NewMoveError(mvUtil.ReasonInvalidParent, "cannot get parent info: %v", err)
+	}
+	if e.Parent == nil {
+		e.addStep("pod has no parent, neither by ownerReferences nor by annotation kubernetes.io/created-by")
+	} else {
+		e.addStep("parent is %v %v, found by %v", e.Parent.Kind, e.Parent.Name, e.Parent.Source)
+		if e.OwnerChain, err = mvUtil.GetOwnerChain(client, pod); err != nil {
+			glog.Warningf("failed to resolve the owners of pod %v: %v", e.Pod, err)
+		}
+	}
+
+	//2. strategy and scheduler
+	parentKind, parentName := "", ""
+	if e.Parent != nil {
+		parentKind, parentName = e.Parent.Kind, e.Parent.Name
+	}
+	e.Strategy = mvUtil.StrategyDirect
+	if parentKind != "" {
+		e.Strategy = mvUtil.StrategySchedulerSwap
+		if moveStrategy != "" {
+			e.Strategy = moveStrategy
+		}
+	}
+	e.addStep("move by strategy %v", e.Strategy)
+
+	if e.Strategy != mvUtil.StrategyDirect {
+		highver := isHighVersion()
+		e.SchedulerAccessor = mvUtil.SchedulerAccessor(highver)
+		helper, err := mvUtil.NewMoveHelper(client, nameSpace, podName, parentKind, parentName, noexistSchedulerName, highver)
+		if err == nil {
+			e.CurrentScheduler, err = helper.GetCurrentScheduler()
+		}
+		if err != nil {
+			e.addStep("cannot swap the scheduler of %v %v: %v", parentKind, parentName, err)
+		} else {
+			e.addStep("set the scheduler of %v %v from [%v] to [%v], by %v (k8sVersion %v)",
+				parentKind, parentName, e.CurrentScheduler, noexistSchedulerName, e.SchedulerAccessor, k8sVersion)
+		}
+	}
+
+	//3. grace period
+	e.GracePeriod = mvUtil.CalcGracePeriod(pod, gracePolicy)
+	switch e.Strategy {
+	case mvUtil.StrategyOrphan:
+		e.addStep("remove a selector label from the pod, and bind the replacement from template of %v %v to node %v", parentKind, parentName, nodeName)
+		e.addStep("delete the orphan pod with grace period %v, after the replacement is running", e.GracePeriod)
+	case mvUtil.StrategyScale:
+		e.addStep("scale up %v %v, and create the copy on node %v as the new replica", parentKind, parentName, nodeName)
+		e.addStep("scale down %v %v after the copy is running, deleting the original with grace period %v if needed",
+			parentKind, parentName, e.GracePeriod)
+	default:
+		timeout := terminationTimeout
+		if timeout <= 0 {
+			timeout = e.GracePeriod.TerminationTimeout()
+		}
+		e.addStep("delete the original pod with grace period %v, and wait at most %v for it to terminate", e.GracePeriod, timeout)
+		if nameFallback {
+			e.addStep("create the copy with spec.nodeName %v, with a generated name if the original pod is still terminating", nodeName)
+		} else {
+			e.addStep("create the copy with spec.nodeName %v", nodeName)
+		}
+	}
+	if e.SchedulerAccessor != "" {
+		e.addStep("restore the scheduler of %v %v, and delete its pending pods", parentKind, parentName)
+	}
+
+	//4. pre-flight verdicts
+	e.Verdict = true
+	e.Unmovable = mvUtil.NewPodAnalyzer(client).Analyze(pod).Reasons
+	if e.Strategy == mvUtil.StrategyScale {
+		if err := mvUtil.CheckScaleParent(client, nameSpace, parentKind, parentName); err != nil {
+			e.Unmovable = append(e.Unmovable, mvUtil.UnmovableReason{Reason: string(mvUtil.ReasonForError(err)), Message: err.Error()})
+		}
+	}
+	if len(e.Unmovable) > 0 {
+		e.Verdict = false
+	}
+	if pod.Spec.NodeName == nodeName {
+		e.Verdict = false
+		e.Unmovable = append(e.Unmovable, mvUtil.UnmovableReason{Reason: string(mvUtil.ReasonAlreadyOnNode), Message: "pod is already on node " + nodeName})
+	}
+
+	node, err := client.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		e.Verdict = false
+		e.Predicates = append(e.Predicates, mvUtil.PredicateResult{Name: "NodeExists", Message: err.Error()})
+	} else {
+		for _, p := range mvUtil.CheckNodePredicates(client, pod, node) {
+			e.Predicates = append(e.Predicates, p)
+			e.Verdict = e.Verdict && p.Passed
+		}
+	}
+
+	//5. downtime
+	downtime, reason := estimateDowntime(pod, e.Strategy, e.GracePeriod)
+	e.Downtime = downtime.String()
+	e.DowntimeReason = reason
+	return e, nil
+}
+
+func printExplanation(e *explanation) {
+	if outputFormat == outputJSON {
+		data, err := json.MarshalIndent(e, "", "  ")
+		if err != nil {
+			glog.Errorf("failed to encode explanation: %v", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Pod:      %v\n", e.Pod)
+	fmt.Printf("Move:     %v -> %v\n", e.SourceNode, e.DestinationNode)
+	if e.Parent != nil {
+		fmt.Printf("Parent:   %v %v (by %v)\n", e.Parent.Kind, e.Parent.Name, e.Parent.Source)
+	} else {
+		fmt.Printf("Parent:   <none>\n")
+	}
+	for i, owner := range e.OwnerChain {
+		fmt.Printf("  owner %d: %v %v %v uid=%v\n", i+1, owner.APIVersion, owner.Kind, owner.Name, owner.UID)
+	}
+	fmt.Printf("Strategy: %v\n", e.Strategy)
+	if e.SchedulerAccessor != "" {
+		fmt.Printf("Scheduler: [%v] by %v\n", e.CurrentScheduler, e.SchedulerAccessor)
+	}
+	fmt.Printf("Grace period: %v\n", e.GracePeriod)
+
+	fmt.Printf("Steps:\n")
+	for i, step := range e.Steps {
+		fmt.Printf("  %d. %v\n", i+1, step)
+	}
+
+	fmt.Printf("Pre-flight:\n")
+	for _, r := range e.Unmovable {
+		fmt.Printf("  [FAIL] %v: %v\n", r.Reason, r.Message)
+	}
+	for _, p := range e.Predicates {
+		verdict := "PASS"
+		if !p.Passed {
+			verdict = "FAIL"
+		}
+		fmt.Printf("  [%v] %v: %v\n", verdict, p.Name, p.Message)
+	}
+
+	fmt.Printf("Estimated downtime: %v (%v)\n", e.Downtime, e.DowntimeReason)
+	fmt.Printf("Movable: %v\n", e.Verdict)
+}
+
+// explain <pod> <node>; the pod and node can also be given by --podName and --nodeName
+func runExplain(kubeClient *kubernetes.Clientset) int {
+	pod, node := podName, nodeName
+	if len(cmdArgs) > 0 {
+		pod = cmdArgs[0]
+	}
+	if len(cmdArgs) > 1 {
+		node = cmdArgs[1]
+	}
+	if node == "" {
+		glog.Errorf("nodeName should not be empty.")
+		return exitInvalidArgs
+	}
+
+	e, err := explainMove(kubeClient, nameSpace, pod, node)
+	if err != nil {
+		glog.Errorf("failed to explain the move of pod %v/%v: %v", nameSpace, pod, err)
+		return exitCodeForError(err)
+	}
+
+	printExplanation(e)
+	return exitOK
+}
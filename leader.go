@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
+
+	mvUtil "movePod/util"
+)
+
+const (
+	leaseDuration = time.Second * 15
+	renewDeadline = time.Second * 10
+	retryPeriod   = time.Second * 2
+
+	// how long to wait for the in-flight moves to finish after the leadership is lost;
+	// a new leader taking over a lock which is not released waits as long before it runs any moves.
+	handoverTimeout = time.Minute * 2
+
+	// the annotation on the ConfigMap holding the leader record, the same one as kube-scheduler uses
+	leaderAnnotationKey = "control-plane.alpha.kubernetes.io/leader"
+
+	eventLeaderElection = "LeaderElection"
+)
+
+// the holder of the lock, saved in the annotation of the ConfigMap
+type leaderRecord struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// leaderLock is a lease on a ConfigMap; it is taken over if its holder does not renew it in leaseDuration.
+// The update of the ConfigMap is guarded by its resourceVersion, so only one instance can take it.
+type leaderLock struct {
+	client    *kubernetes.Clientset
+	nameSpace string
+	name      string
+	id        string
+	recorder  record.EventRecorder
+
+	// the record last seen, and when it was seen by the local clock, as the clocks of the instances may differ
+	observed     leaderRecord
+	observedTime time.Time
+
+	// the lock was taken from another holder whose lease expired, instead of released by it
+	takenOver bool
+}
+
+func (l *leaderLock) recordEvent(cm *v1.ConfigMap, format string, a ...interface{}) {
+	mvUtil.RecordEvent(l.recorder, cm, v1.EventTypeNormal, eventLeaderElection, format, a...)
+}
+
+// take the lock, or renew it if it is held by this instance; return true if this instance holds it.
+func (l *leaderLock) tryAcquireOrRenew() bool {
+	now := metav1.Now()
+	leader := leaderRecord{
+		HolderIdentity:       l.id,
+		LeaseDurationSeconds: int(leaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	cms := l.client.CoreV1().ConfigMaps(l.nameSpace)
+	cm, err := cms.Get(l.name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			glog.Errorf("failed to get leader lock %v/%v: %v", l.nameSpace, l.name, err)
+			return false
+		}
+
+		data, _ := json.Marshal(leader)
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   l.nameSpace,
+				Name:        l.name,
+				Annotations: map[string]string{leaderAnnotationKey: string(data)},
+			},
+		}
+		if cm, err = cms.Create(cm); err != nil {
+			glog.Errorf("failed to create leader lock %v/%v: %v", l.nameSpace, l.name, err)
+			return false
+		}
+		l.observed, l.observedTime = leader, time.Now()
+		l.recordEvent(cm, "%v became leader", l.id)
+		return true
+	}
+
+	old := leaderRecord{}
+	if value, ok := cm.Annotations[leaderAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(value), &old); err != nil {
+			glog.Warningf("invalid leader record of %v/%v, taking it over: %v", l.nameSpace, l.name, err)
+		}
+	}
+	if !reflect.DeepEqual(old, l.observed) {
+		l.observed, l.observedTime = old, time.Now()
+	}
+
+	if old.HolderIdentity != "" && old.HolderIdentity != l.id &&
+		time.Since(l.observedTime) < time.Duration(old.LeaseDurationSeconds)*time.Second {
+		glog.V(4).Infof("leader lock %v/%v is held by %v", l.nameSpace, l.name, old.HolderIdentity)
+		return false
+	}
+
+	takenOver := false
+	if old.HolderIdentity == l.id {
+		leader.AcquireTime = old.AcquireTime
+		leader.LeaderTransitions = old.LeaderTransitions
+	} else {
+		leader.LeaderTransitions = old.LeaderTransitions + 1
+		takenOver = old.HolderIdentity != ""
+	}
+
+	data, _ := json.Marshal(leader)
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	cm.Annotations[leaderAnnotationKey] = string(data)
+	if cm, err = cms.Update(cm); err != nil {
+		glog.Errorf("failed to update leader lock %v/%v: %v", l.nameSpace, l.name, err)
+		return false
+	}
+
+	l.observed, l.observedTime = leader, time.Now()
+	if old.HolderIdentity != l.id {
+		l.takenOver = takenOver
+		l.recordEvent(cm, "%v became leader", l.id)
+	}
+	return true
+}
+
+// give up the lock if it is still held by this instance, so that the next leader need not wait for the handover.
+func (l *leaderLock) release() {
+	cms := l.client.CoreV1().ConfigMaps(l.nameSpace)
+	cm, err := cms.Get(l.name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("failed to get leader lock %v/%v: %v", l.nameSpace, l.name, err)
+		return
+	}
+
+	old := leaderRecord{}
+	if err := json.Unmarshal([]byte(cm.Annotations[leaderAnnotationKey]), &old); err != nil || old.HolderIdentity != l.id {
+		return
+	}
+
+	//an empty holder is taken at once by the others
+	old.HolderIdentity = ""
+	data, _ := json.Marshal(old)
+	cm.Annotations[leaderAnnotationKey] = string(data)
+	if _, err := cms.Update(cm); err != nil {
+		glog.Errorf("failed to release leader lock %v/%v: %v", l.nameSpace, l.name, err)
+		return
+	}
+	glog.V(2).Infof("%v released the leader lock %v/%v", l.id, l.nameSpace, l.name)
+}
+
+// block until the lock is taken
+func (l *leaderLock) acquire() {
+	glog.V(2).Infof("%v is waiting for the leader lock %v/%v", l.id, l.nameSpace, l.name)
+	wait.PollInfinite(retryPeriod, func() (bool, error) {
+		return l.tryAcquireOrRenew(), nil
+	})
+}
+
+// renew the lock every retryPeriod, until it cannot be renewed in renewDeadline
+func (l *leaderLock) renew() {
+	for {
+		err := wait.Poll(retryPeriod, renewDeadline, func() (bool, error) {
+			return l.tryAcquireOrRenew(), nil
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// run the long-running mode; with leader election, only the leader executes the moves.
+// run should return only after stop is closed and its in-flight moves are finished,
+// so that the next leader can take over cleanly; the moves which have not deleted their pods yet should be cancelled by stop.
+// A previous leader may still be finishing its moves when its lease expires, e.g. restoring the scheduler of a parent,
+// so the lock taken over from it is only used after handoverTimeout, when the previous leader has exited.
+func runLeaderElected(kubeClient *kubernetes.Clientset, run func(stop <-chan struct{})) int {
+	if !leaderElect {
+		run(make(chan struct{}))
+		return exitOK
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		glog.Errorf("failed to get hostname: %v", err)
+		return exitUnknown
+	}
+
+	recorder := eventRecorder
+	if recorder == nil {
+		recorder = mvUtil.NewEventRecorder(kubeClient)
+	}
+
+	lock := &leaderLock{
+		client:    kubeClient,
+		nameSpace: leaderElectNameSpace,
+		name:      leaderElectName,
+		id:        fmt.Sprintf("%v_%d", host, os.Getpid()),
+		recorder:  recorder,
+	}
+
+	lock.acquire()
+	glog.V(2).Infof("%v became the leader of %v/%v", lock.id, leaderElectNameSpace, leaderElectName)
+
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		lock.renew()
+	}()
+
+	if lock.takenOver {
+		glog.V(2).Infof("%v is waiting %v for the moves of the previous leader to finish", lock.id, handoverTimeout)
+		select {
+		case <-lost:
+			glog.Warningf("%v lost the leadership before running any moves", lock.id)
+			return exitUnknown
+		case <-time.After(handoverTimeout):
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(stop)
+	}()
+
+	<-lost
+	close(stop)
+
+	glog.Warningf("%v lost the leadership, waiting for in-flight moves to finish", lock.id)
+	select {
+	case <-done:
+		lock.release()
+	case <-time.After(handoverTimeout):
+		glog.Errorf("in-flight moves are not finished in %v", handoverTimeout)
+	}
+
+	//exit, so that this instance is restarted and joins the election again
+	return exitUnknown
+}
@@ -1,26 +1,80 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/golang/glog"
+	"movePod/metrics"
 	mvUtil "movePod/util"
+	"os"
+	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 //global variables
 var (
 	masterUrl            string
 	kubeConfig           string
+	kubeContext          string
+	clientQPS            float64
+	clientBurst          int
 	nameSpace            string
 	podName              string
 	noexistSchedulerName string
 	nodeName             string
 	k8sVersion           string
+	outputFormat         string
+	backupDir            string
+	backupFile           string
+	metricsAddr          string
+	recordEvents         bool
+	healthTimeout        time.Duration
+	listenAddr           string
+	serverWorkers        int
+	watchNameSpace       string
+	checkPermissions     bool
+	dryRun               bool
+	moveStrategy         string
+	rolloutCheck         string
+	rolloutTimeout       time.Duration
+	pauseDeployment      bool
+	sanitizePolicyFile   string
+	stripFields          string
+	keepFields           string
+	addLabels            string
+	removeLabels         string
+	addAnnotations       string
+	removeAnnotations    string
+	addTolerations       string
+	setRequests          string
+	setLimits            string
+	resourceContainer    string
+	leaderElect          bool
+	leaderElectNameSpace string
+	leaderElectName      string
+
+	// the positional arguments of the sub-command, e.g. the pod and node of explain
+	cmdArgs []string
+	allNameSpaces        bool
+	gracePeriod          int64
+	maxGracePeriod       int64
+	forceDelete          bool
+	terminationTimeout   time.Duration
+	nameFallback         bool
+
+	eventRecorder record.EventRecorder
+	//the sanitize policy given by the user, merged with the defaults of each move
+	userSanitizePolicy *mvUtil.SanitizePolicy
+	//changes to the pod copy given by the flags; nil if none
+	podMutation *mvUtil.PodMutation
+	//the grace period to delete the original pod with; nil for the pod's own
+	gracePolicy *mvUtil.GracePolicy
 )
 
 const (
@@ -28,19 +82,286 @@ const (
 	DefaultNoneExistSchedulerName = "turbo-none-exist-scheduler"
 	defaultRetryLess                    = 2
 	highK8sVersion = "1.6"
+	eventFlushWait = time.Second
+
+	// sub-commands
+	cmdMove       = "move"
+	cmdRestore    = "restore"
+	cmdServe      = "serve"
+	cmdController = "controller"
+	cmdReconcile  = "reconcile"
+	cmdResize     = "resize"
+	cmdAnalyze    = "analyze"
+	cmdExplain    = "explain"
+
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// how many positional arguments a sub-command takes; none if not listed
+var cmdMaxArgs = map[string]int{
+	cmdExplain: 2,
+}
+
+// process exit codes, so that automation can branch on the outcome
+const (
+	exitOK                    = 0
+	exitUnknown               = 1
+	exitInvalidArgs           = 2
+	exitClientFailed          = 3
+	exitGetPodFailed          = 4
+	exitAlreadyOnNode         = 5
+	exitInvalidParent         = 6
+	exitUnsupportedParent     = 7
+	exitSchedulerUpdateFailed = 8
+	exitBackupFailed          = 9
+	exitDeleteFailed          = 10
+	exitCreateFailed          = 11
+	exitHealthCheckFailed     = 12
+	exitSchedulerRestore      = 13
+	exitPermissionDenied      = 14
+	exitOrphanFailed          = 15
+	exitScaleFailed           = 16
+	exitRolloutInProgress     = 17
+	exitPodChanged            = 18
+	exitTerminationTimeout    = 19
+	exitCancelled             = 20
+	exitInvalidInput          = 21
+	exitInsufficientResources = 22
+	exitGetNodeFailed         = 23
 )
 
+var exitCodes = map[mvUtil.ErrorReason]int{
+	mvUtil.ReasonGetPodFailed:           exitGetPodFailed,
+	mvUtil.ReasonAlreadyOnNode:          exitAlreadyOnNode,
+	mvUtil.ReasonInvalidParent:          exitInvalidParent,
+	mvUtil.ReasonUnsupportedParent:      exitUnsupportedParent,
+	mvUtil.ReasonSchedulerUpdateFailed:  exitSchedulerUpdateFailed,
+	mvUtil.ReasonBackupFailed:           exitBackupFailed,
+	mvUtil.ReasonDeleteFailed:           exitDeleteFailed,
+	mvUtil.ReasonCreateFailed:           exitCreateFailed,
+	mvUtil.ReasonHealthCheckFailed:      exitHealthCheckFailed,
+	mvUtil.ReasonSchedulerRestoreFailed: exitSchedulerRestore,
+	mvUtil.ReasonPermissionDenied:       exitPermissionDenied,
+	mvUtil.ReasonOrphanFailed:           exitOrphanFailed,
+	mvUtil.ReasonScaleFailed:            exitScaleFailed,
+	mvUtil.ReasonRolloutInProgress:      exitRolloutInProgress,
+	mvUtil.ReasonPodChanged:             exitPodChanged,
+	mvUtil.ReasonTerminationTimeout:     exitTerminationTimeout,
+	mvUtil.ReasonCancelled:              exitCancelled,
+	mvUtil.ReasonInvalidInput:           exitInvalidInput,
+	mvUtil.ReasonInsufficientResources:  exitInsufficientResources,
+	mvUtil.ReasonGetNodeFailed:          exitGetNodeFailed,
+}
+
+func exitCodeForError(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	if code, ok := exitCodes[mvUtil.ReasonForError(err)]; ok {
+		return code
+	}
+	return exitUnknown
+}
+
 func setFlags() {
 	flag.StringVar(&masterUrl, "masterUrl", "", "master url")
-	flag.StringVar(&kubeConfig, "kubeConfig", "", "absolute path to the kubeconfig file")
+	flag.StringVar(&kubeConfig, "kubeConfig", "", "absolute path to the kubeconfig file; the in-cluster config is used if neither masterUrl nor kubeConfig is given")
+	flag.StringVar(&kubeContext, "context", "", "the context in the kubeconfig to use; the current context if empty")
+	flag.Float64Var(&clientQPS, "kubeQPS", 5, "QPS of the client to the apiserver")
+	flag.IntVar(&clientBurst, "kubeBurst", 10, "burst of the client to the apiserver")
 	flag.StringVar(&nameSpace, "nameSpace", "default", "kubernetes object namespace")
 	flag.StringVar(&podName, "podName", "myschedule-cpu-80", "the podName to be handled")
 	flag.StringVar(&noexistSchedulerName, "scheduler-name", DefaultNoneExistSchedulerName, "the name of the none-exist-scheduler")
 	flag.StringVar(&nodeName, "nodeName", "", "Destination of move")
 	flag.StringVar(&k8sVersion, "k8sVersion", "1.6", "the version of Kubenetes cluster, candidates are 1.5 | 1.6")
+	flag.StringVar(&outputFormat, "output", outputText, "format of the result: text | json")
+	flag.StringVar(&backupDir, "backupDir", "./backup", "directory to backup the pod before deleting it; disable backup if empty")
+	flag.StringVar(&backupFile, "backupFile", "", "the backup file to restore the pod from, for restore command")
+	flag.DurationVar(&healthTimeout, "healthTimeout", time.Second*10, "how long to wait for the moved pod to be running")
+	flag.BoolVar(&recordEvents, "recordEvents", true, "record Kubernetes Events on the pods and controllers during the move")
+	flag.StringVar(&listenAddr, "listenAddr", ":8080", "address to serve the move API on, for serve command")
+	flag.IntVar(&serverWorkers, "workers", 4, "number of workers to execute the moves, for serve command")
+	flag.StringVar(&watchNameSpace, "watchNamespace", "", "namespace to watch for move requests, for controller and reconcile commands; all namespaces if empty")
+	flag.BoolVar(&checkPermissions, "checkPermissions", true, "check the RBAC permissions needed by the move before changing anything")
+	flag.StringVar(&moveStrategy, "strategy", "", "move strategy for pods with a parent: schedulerSwap | orphan | scale; schedulerSwap if empty")
+	flag.StringVar(&rolloutCheck, "rolloutCheck", rolloutRefuse, "what to do if the pod's ReplicaSet is not the current revision of its Deployment, or the rollout is in progress: refuse | wait | ignore")
+	flag.DurationVar(&rolloutTimeout, "rolloutTimeout", time.Minute*5, "how long to wait for the rollout, with --rolloutCheck=wait")
+	flag.BoolVar(&pauseDeployment, "pauseDeployment", false, "pause the Deployment of the pod during the move")
+	flag.Int64Var(&gracePeriod, "gracePeriod", -1, "grace period in seconds to delete the original pod with, instead of the pod's own; the pod's own if negative")
+	flag.Int64Var(&maxGracePeriod, "maxGracePeriod", -1, "cap in seconds of the pod's own grace period; no cap if negative")
+	flag.BoolVar(&forceDelete, "force", false, "allow the grace period 0, which force-deletes the original pod; it is raised to 1s otherwise")
+	flag.DurationVar(&terminationTimeout, "terminationTimeout", 0, "how long to wait for the original pod to be gone before creating its copy; the grace period plus 10s if 0")
+	flag.BoolVar(&nameFallback, "generateNameFallback", false, "create the copy with a generated name if the original pod is still terminating after --terminationTimeout, unless the pod depends on its name")
+	flag.BoolVar(&dryRun, "dryRun", false, "show what the move would do without changing anything, for move command")
+	flag.StringVar(&sanitizePolicyFile, "sanitizePolicy", "", "JSON file of the policy to strip, keep or override the fields of the pod copy")
+	flag.StringVar(&stripFields, "stripFields", "", "comma-separated fields to strip from the pod copy, e.g. metadata.annotations[foo/bar]")
+	flag.StringVar(&keepFields, "keepFields", "", "comma-separated fields to keep in the pod copy, e.g. spec.hostname")
+	flag.StringVar(&addLabels, "addLabels", "", "labels to add to the pod copy: k1=v1,k2=v2")
+	flag.StringVar(&removeLabels, "removeLabels", "", "labels to remove from the pod copy: k1,k2")
+	flag.StringVar(&addAnnotations, "addAnnotations", "", "annotations to add to the pod copy: k1=v1,k2=v2")
+	flag.StringVar(&removeAnnotations, "removeAnnotations", "", "annotations to remove from the pod copy: k1,k2")
+	flag.StringVar(&addTolerations, "addTolerations", "", "tolerations to add to the pod copy: key=value:Effect,key:Effect")
+	flag.StringVar(&setRequests, "requests", "", "resource requests to set in the pod copy: cpu=100m,memory=128Mi")
+	flag.StringVar(&setLimits, "limits", "", "resource limits to set in the pod copy: cpu=200m,memory=256Mi")
+	flag.StringVar(&resourceContainer, "container", "", "the container whose requests/limits are set; all the containers if empty")
+	flag.BoolVar(&leaderElect, "leaderElect", false, "run leader election for serve, controller and reconcile commands, so that only one instance executes the moves")
+	flag.StringVar(&leaderElectNameSpace, "leaderElectNamespace", "default", "namespace of the leader election lock")
+	flag.StringVar(&leaderElectName, "leaderElectName", "movepod-leader", "name of the ConfigMap used as the leader election lock")
+	flag.BoolVar(&allNameSpaces, "allNamespaces", false, "analyze the pods of all the namespaces, for analyze command")
+	flag.StringVar(&metricsAddr, "metricsAddr", "", "address to serve Prometheus metrics on for long-running modes, e.g. :8081; disabled if empty")
 
 	flag.Set("alsologtostderr", "true")
 	flag.Parse()
+
+	//flags may follow the positional arguments, e.g. "explain mypod node1 --nameSpace x"
+	for args := flag.Args(); len(args) > 0; args = flag.Args() {
+		cmdArgs = append(cmdArgs, args[0])
+		flag.CommandLine.Parse(args[1:])
+	}
+}
+
+// the first argument can be a sub-command; "move" is the default
+func parseCommand() string {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		cmd := os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		return cmd
+	}
+
+	return cmdMove
+}
+
+func buildClientOptions() *mvUtil.ClientOptions {
+	return &mvUtil.ClientOptions{
+		MasterUrl:  masterUrl,
+		KubeConfig: kubeConfig,
+		Context:    kubeContext,
+		QPS:        float32(clientQPS),
+		Burst:      clientBurst,
+	}
+}
+
+// load the sanitize policy from the file and flags
+func loadSanitizePolicy() (*mvUtil.SanitizePolicy, error) {
+	policy := &mvUtil.SanitizePolicy{}
+	if sanitizePolicyFile != "" {
+		var err error
+		if policy, err = mvUtil.LoadSanitizePolicy(sanitizePolicyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if stripFields != "" {
+		policy.Strip = append(policy.Strip, strings.Split(stripFields, ",")...)
+	}
+	if keepFields != "" {
+		policy.Keep = append(policy.Keep, strings.Split(keepFields, ",")...)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// load the changes to the pod copy from the flags; return nil if there is no change
+func loadPodMutation() (*mvUtil.PodMutation, error) {
+	var err error
+	m := &mvUtil.PodMutation{
+		RemoveLabels:      splitList(removeLabels),
+		RemoveAnnotations: splitList(removeAnnotations),
+		Container:         resourceContainer,
+	}
+
+	if m.AddLabels, err = mvUtil.ParseKeyValues(addLabels); err != nil {
+		return nil, fmt.Errorf("invalid addLabels: %v", err)
+	}
+	if m.AddAnnotations, err = mvUtil.ParseKeyValues(addAnnotations); err != nil {
+		return nil, fmt.Errorf("invalid addAnnotations: %v", err)
+	}
+	if m.Tolerations, err = mvUtil.ParseTolerations(addTolerations); err != nil {
+		return nil, fmt.Errorf("invalid addTolerations: %v", err)
+	}
+	if m.Requests, err = mvUtil.ParseResourceList(setRequests); err != nil {
+		return nil, fmt.Errorf("invalid requests: %v", err)
+	}
+	if m.Limits, err = mvUtil.ParseResourceList(setLimits); err != nil {
+		return nil, fmt.Errorf("invalid limits: %v", err)
+	}
+
+	if m.IsEmpty() {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// the grace policy given by --gracePeriod, --maxGracePeriod and --force; nil if none is given
+func buildGracePolicy() *mvUtil.GracePolicy {
+	if gracePeriod < 0 && maxGracePeriod < 0 && !forceDelete {
+		return nil
+	}
+
+	policy := &mvUtil.GracePolicy{Force: forceDelete}
+	if gracePeriod >= 0 {
+		policy.Override = &gracePeriod
+	}
+	if maxGracePeriod >= 0 {
+		policy.Max = &maxGracePeriod
+	}
+	return policy
+}
+
+// the sanitize policy for the pod copy: the defaults for the k8s version, with the user's rules
+func buildSanitizePolicy() *mvUtil.SanitizePolicy {
+	return mvUtil.DefaultSanitizePolicy(isHighVersion()).Merge(userSanitizePolicy)
+}
+
+func buildMoveOptions(trace *mvUtil.MoveTrace) *mvUtil.MoveOptions {
+	return &mvUtil.MoveOptions{
+		RetryNum:  defaultRetryLess,
+		BackupDir: backupDir,
+		Trace:     trace,
+		Recorder:  eventRecorder,
+		Mutation:  podMutation,
+		Grace:     gracePolicy,
+
+		TerminationTimeout: terminationTimeout,
+		NameFallback:       nameFallback,
+	}
+}
+
+// serve the Prometheus metrics if metricsAddr is set; only useful for long-running modes.
+func startMetricsServer() {
+	if metricsAddr == "" {
+		return
+	}
+	metrics.Serve(metricsAddr)
+}
+
+// record an event on the parent controller, if its reference is available
+func recordParentEvent(ref *v1.ObjectReference, eventType, reason, format string, a ...interface{}) {
+	if ref == nil {
+		return
+	}
+	mvUtil.RecordEvent(eventRecorder, ref, eventType, reason, format, a...)
+}
+
+// print the result as a single JSON document to stdout
+func printResult(trace *mvUtil.MoveTrace) {
+	data, err := json.MarshalIndent(trace, "", "  ")
+	if err != nil {
+		glog.Errorf("failed to encode result: %v", err)
+		return
+	}
+	fmt.Println(string(data))
 }
 
 func addErrors(prefix string, err1, err2 error) error {
@@ -57,12 +378,15 @@ func addErrors(prefix string, err1, err2 error) error {
 	return rerr
 }
 
-// update the parent's scheduler before moving pod; then restore parent's scheduler
-func doSchedulerMove(client *kubernetes.Clientset, pod *v1.Pod, parentKind, parentName, nodeName string) error {
-	highver := true
-	if mvUtil.CompareVersion(k8sVersion, highK8sVersion) < 0 {
-		highver = false
-	}
+// whether the schedulerName is set in the field (k8s >= 1.6), instead of the annotation
+func isHighVersion() bool {
+	return mvUtil.CompareVersion(k8sVersion, highK8sVersion) >= 0
+}
+
+// update the parent's scheduler before moving pod by move; then restore parent's scheduler
+func doSchedulerMove(client *kubernetes.Clientset, pod *v1.Pod, parentKind, parentName, nodeName string, opts *mvUtil.MoveOptions,
+	move func() error) (err error) {
+	highver := isHighVersion()
 
 	noexist := noexistSchedulerName
 	helper, err := mvUtil.NewMoveHelper(client, pod.Namespace, pod.Name, parentKind, parentName, noexist, highver)
@@ -71,29 +395,80 @@ func doSchedulerMove(client *kubernetes.Clientset, pod *v1.Pod, parentKind, pare
 		return err
 	}
 
+	trace := opts.Trace
+	parentRef, rerr := mvUtil.GetControllerReference(client, pod.Namespace, parentKind, parentName)
+	if rerr != nil {
+		glog.Warningf("cannot get reference of %v-%v/%v, no events will be recorded on it: %v",
+			parentKind, pod.Namespace, parentName, rerr)
+		parentRef = nil
+	}
+
 	//1. invalid the original scheduler
+	if opts.IsCancelled() {
+		return mvUtil.NewMoveError(mvUtil.ReasonCancelled, "move-aborted: move of pod-%v/%v is cancelled", pod.Namespace, pod.Name)
+	}
+
+	t0 := time.Now()
 	preScheduler, err := helper.UpdateScheduler(noexist, defaultRetryLess)
 	if err != nil {
+		trace.AddPhase(mvUtil.PhaseSchedulerSwap, t0, err)
+		recordParentEvent(parentRef, v1.EventTypeWarning, mvUtil.EventSchedulerSwapFailed,
+			"Failed to change scheduler to [%v] for moving pod %v: %v", noexist, pod.Name, err)
 		glog.Errorf("move failed: %v", err)
-		return err
+		return mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed, "move-aborted: failed to update scheduler: %v", err)
+	}
+	//another process is moving a pod of the parent; leave the scheduler to it to restore
+	if preScheduler == noexist {
+		trace.AddPhase(mvUtil.PhaseSchedulerSwap, t0, fmt.Errorf("scheduler is already [%v]", noexist))
+		return mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed,
+			"move-aborted: %v %v/%v is being used by another move", parentKind, pod.Namespace, parentName)
 	}
 	helper.SetScheduler(preScheduler)
+	metrics.IncSwappedControllers()
+	recordParentEvent(parentRef, v1.EventTypeNormal, mvUtil.EventSchedulerSwapped,
+		"Changed scheduler from [%v] to [%v] for moving pod %v to node %v", preScheduler, noexist, pod.Name, nodeName)
 	defer func() {
-		helper.CleanUp()
-		mvUtil.CleanPendingPod(client, pod.Namespace, noexist, parentKind, parentName, highver)
+		t1 := time.Now()
+		restored, rerr := helper.CleanUp()
+		trace.AddPhase(mvUtil.PhaseSchedulerRestore, t1, rerr)
+		if rerr == nil {
+			metrics.DecSwappedControllers()
+		}
+		if restored {
+			trace.AddCleanup(fmt.Sprintf("restored scheduler of %v %v/%v to [%v]",
+				parentKind, pod.Namespace, parentName, helper.GetScheduler()))
+			recordParentEvent(parentRef, v1.EventTypeNormal, mvUtil.EventSchedulerRestored,
+				"Restored scheduler to [%v] after moving pod %v", helper.GetScheduler(), pod.Name)
+		}
+		if rerr != nil {
+			recordParentEvent(parentRef, v1.EventTypeWarning, mvUtil.EventSchedulerRestoreFailed,
+				"Failed to restore scheduler to [%v] after moving pod %v: %v", helper.GetScheduler(), pod.Name, rerr)
+		}
+
+		deleted, _ := mvUtil.CleanPendingPod(client, pod.Namespace, noexist, parentKind, parentName, highver)
+		for _, name := range deleted {
+			trace.AddCleanup(fmt.Sprintf("deleted pending pod %v/%v", pod.Namespace, name))
+		}
+
+		//the move itself succeeded, but the parent is left with the none-exist scheduler
+		if err == nil && rerr != nil {
+			err = rerr
+		}
 	}()
 
 	//Is this necessary?
 	if flag, err := helper.CheckScheduler(noexist, 1); err != nil || !flag {
+		trace.AddPhase(mvUtil.PhaseSchedulerSwap, t0, fmt.Errorf("failed to check scheduler."))
 		glog.Errorf("move failed: failed to check scheduler.")
-		return fmt.Errorf("failed to check scheduler.")
+		return mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed, "failed to check scheduler.")
 	}
+	trace.AddPhase(mvUtil.PhaseSchedulerSwap, t0, nil)
 
 	//2. do the move
-	return mvUtil.MovePod(client, pod, nodeName, defaultRetryLess)
+	return move()
 }
 
-func movePod(client *kubernetes.Clientset, nameSpace, podName, nodeName string) error {
+func movePod(client *kubernetes.Clientset, nameSpace, podName, nodeName string, opts *mvUtil.MoveOptions) error {
 	podClient := client.CoreV1().Pods(nameSpace)
 	id := fmt.Sprintf("%v/%v", nameSpace, podName)
 
@@ -101,61 +476,273 @@ func movePod(client *kubernetes.Clientset, nameSpace, podName, nodeName string)
 	getOption := metav1.GetOptions{}
 	pod, err := podClient.Get(podName, getOption)
 	if err != nil {
-		err = fmt.Errorf("move-aborted: get original pod:%v\n%v", id, err.Error())
-		glog.Error(err.Error())
-		return err
+		merr := mvUtil.NewMoveError(mvUtil.ReasonGetPodFailed, "move-aborted: get original pod:%v\n%v", id, err.Error())
+		glog.Error(merr.Error())
+		return merr
 	}
 
 	if pod.Spec.NodeName == nodeName {
-		err = fmt.Errorf("move-aborted: pod %v is already on node: %v", id, nodeName)
-		glog.Error(err.Error())
-		return err
+		merr := mvUtil.NewMoveError(mvUtil.ReasonAlreadyOnNode, "move-aborted: pod %v is already on node: %v", id, nodeName)
+		glog.Error(merr.Error())
+		return merr
 	}
 
 	glog.V(2).Infof("move-pod: begin to move %v from %v to %v",
 		id, pod.Spec.NodeName, nodeName)
+	return moveParentedPod(client, pod, nodeName, opts)
+}
+
+// move the pod by the strategy for its parent: directly for a standalone pod,
+// or by swapping the scheduler of the parent, or by orphaning the pod from the parent.
+func moveParentedPod(client *kubernetes.Clientset, pod *v1.Pod, nodeName string, opts *mvUtil.MoveOptions) error {
+	trace := opts.Trace
+	nameSpace := pod.Namespace
+	id := fmt.Sprintf("%v/%v", nameSpace, pod.Name)
+	trace.SetSource(pod.Spec.NodeName)
 
 	//2. invalidate the schedulerName of parent controller
 	parentKind, parentName, err := mvUtil.ParseParentInfo(pod)
 	if err != nil {
-		return fmt.Errorf("move-abort: cannot get pod-%v parent info: %v", id, err.Error())
+		return mvUtil.NewMoveError(mvUtil.ReasonInvalidParent, "move-abort: cannot get pod-%v parent info: %v", id, err.Error())
 	}
 
-	//2.1 if pod is barely standalone pod, move it directly
-	if parentKind == "" {
-		return mvUtil.MovePod(client, pod, nodeName, defaultRetryLess)
+	trace.SetParent(parentKind, parentName)
+	opts.Policy = buildSanitizePolicy()
+
+	strategy := mvUtil.StrategyDirect
+	if parentKind != "" {
+		strategy = mvUtil.StrategySchedulerSwap
+		if moveStrategy != "" {
+			strategy = moveStrategy
+		}
 	}
 
+	if checkPermissions {
+		req := &mvUtil.PermissionRequest{NameSpace: nameSpace, ParentKind: parentKind, Strategy: strategy,
+			CheckRollout: rolloutCheck != rolloutIgnore, PauseDeployment: pauseDeployment, HighVersion: isHighVersion()}
+		if err := mvUtil.PreflightPermissions(client, req); err != nil {
+			glog.Error(err.Error())
+			return err
+		}
+	}
+
+	//moves of the pods of the same parent are serialized, as they swap the same scheduler
+	if parentKind != "" {
+		key := parentKey(nameSpace, parentKind, parentName)
+		if !parentLocks.Lock(key, opts.Cancel) {
+			return mvUtil.NewMoveError(mvUtil.ReasonCancelled, "move-aborted: move of pod-%v is cancelled", id)
+		}
+		defer parentLocks.Unlock(key)
+	}
+
+	resume, err := guardRollout(client, nameSpace, parentKind, parentName, trace)
+	if err != nil {
+		glog.Error(err.Error())
+		return err
+	}
+	defer resume()
+
+	trace.SetStrategy(strategy)
+	switch strategy {
+	//2.1 if pod is barely standalone pod, move it directly
+	case mvUtil.StrategyDirect:
+		return mvUtil.MovePod(client, pod, nodeName, opts)
+
 	//2.2 if pod controlled by ReplicationController/ReplicaSet, then need to do more
-	return doSchedulerMove(client, pod, parentKind, parentName, nodeName)
-}
+	case mvUtil.StrategySchedulerSwap:
+		return doSchedulerMove(client, pod, parentKind, parentName, nodeName, opts, func() error {
+			return mvUtil.MovePod(client, pod, nodeName, opts)
+		})
 
-func main() {
-	setFlags()
-	defer glog.Flush()
+	//2.3 add the copy as a new replica of the parent, and scale the parent down to remove the original;
+	//    the scheduler is swapped meanwhile, so the replica created by the parent is never scheduled.
+	case mvUtil.StrategyScale:
+		if err := mvUtil.CheckScaleParent(client, nameSpace, parentKind, parentName); err != nil {
+			glog.Error(err.Error())
+			return err
+		}
+		return doSchedulerMove(client, pod, parentKind, parentName, nodeName, opts, func() error {
+			npod, err := mvUtil.ScaleMovePod(client, pod, parentKind, parentName, nodeName, opts)
+			if npod != nil {
+				trace.SetNewPod(npod.Name)
+			}
+			return err
+		})
 
-	kubeClient := mvUtil.GetKubeClient(masterUrl, kubeConfig)
-	if kubeClient == nil {
-		glog.Errorf("failed to get a k8s client for masterUrl=[%v], kubeConfig=[%v]", masterUrl, kubeConfig)
-		return
+	//2.4 let the parent create the replacement, without changing its template or replicas;
+	//    the scheduler is swapped meanwhile, so the replacement is left for us to bind.
+	case mvUtil.StrategyOrphan:
+		return doSchedulerMove(client, pod, parentKind, parentName, nodeName, opts, func() error {
+			npod, err := mvUtil.OrphanMovePod(client, pod, parentKind, parentName, nodeName, opts)
+			if npod != nil {
+				trace.SetNewPod(npod.Name)
+			}
+			return err
+		})
 	}
 
+	return mvUtil.NewMoveError(mvUtil.ReasonUnknown, "move-aborted: unsupported strategy: %v", strategy)
+}
+
+func runMove(kubeClient *kubernetes.Clientset) int {
 	if nodeName == "" {
 		glog.Errorf("nodeName should not be empty.")
-		return
+		return exitInvalidArgs
+	}
+
+	if dryRun {
+		return runDryRun(kubeClient)
 	}
 
-	if err := movePod(kubeClient, nameSpace, podName, nodeName); err != nil {
+	trace := mvUtil.NewMoveTrace(fmt.Sprintf("%v/%v", nameSpace, podName), nodeName)
+	err := moveAndCheck(kubeClient, nameSpace, podName, nodeName, buildMoveOptions(trace))
+	trace.Finish(err)
+
+	result := trace.Result()
+	metrics.ObserveMove(&result)
+	if outputFormat == outputJSON {
+		printResult(trace)
+	}
+
+	return exitCodeForError(err)
+}
+
+func moveAndCheck(kubeClient *kubernetes.Clientset, nameSpace, podName, nodeName string, opts *mvUtil.MoveOptions) error {
+	if err := movePod(kubeClient, nameSpace, podName, nodeName, opts); err != nil {
 		glog.Errorf("move pod failed: %v/%v, %v", nameSpace, podName, err.Error())
-		return
+		return err
+	}
+
+	//the pod may be replaced by one with another name
+	if result := opts.Trace.Result(); result.NewPod != "" {
+		podName = result.NewPod
 	}
+	return checkMovedPod(kubeClient, nameSpace, podName, nodeName, opts)
+}
+
+// wait for the moved pod to be running on the node, and record the result
+func checkMovedPod(kubeClient *kubernetes.Clientset, nameSpace, podName, nodeName string, opts *mvUtil.MoveOptions) error {
 
-	glog.V(2).Infof("sleep 10 seconds to check the final state")
-	time.Sleep(time.Second * 10)
-	if err := mvUtil.CheckPodMoveHealth(kubeClient, nameSpace, podName, nodeName); err != nil {
+	glog.V(2).Infof("wait at most %v to check the final state", healthTimeout)
+	t0 := time.Now()
+	npod, err := mvUtil.WaitPodMoveHealth(kubeClient, nameSpace, podName, nodeName, healthTimeout)
+	opts.Trace.AddPhase(mvUtil.PhaseReady, t0, err)
+	if err != nil {
+		if npod != nil {
+			mvUtil.RecordEvent(eventRecorder, npod, v1.EventTypeWarning, mvUtil.EventMoveFailed,
+				"Pod is not healthy after moving to node %v: %v", nodeName, err)
+		}
 		glog.Errorf("move pod failed: %v", err.Error())
-		return
+		return err
 	}
+	mvUtil.RecordEvent(eventRecorder, npod, v1.EventTypeNormal, mvUtil.EventMoveSucceeded,
+		"Pod is running after moving to node %v", nodeName)
 
 	glog.V(2).Infof("move pod(%v/%v) to node-%v successfully", nameSpace, podName, nodeName)
+	return nil
+}
+
+// re-create a pod from a local backup, which is saved by MovePod before deleting the original pod.
+func runRestore(kubeClient *kubernetes.Clientset) int {
+	if backupFile == "" {
+		glog.Errorf("backupFile should not be empty.")
+		return exitInvalidArgs
+	}
+
+	pod, err := mvUtil.RestorePod(kubeClient, backupFile, nodeName)
+	if err != nil {
+		glog.Errorf("restore pod failed: %v", err.Error())
+		return exitCodeForError(err)
+	}
+
+	glog.V(2).Infof("restore pod(%v/%v) on node-%v successfully", pod.Namespace, pod.Name, pod.Spec.NodeName)
+	return exitOK
+}
+
+func run() int {
+	cmd := parseCommand()
+	setFlags()
+	defer glog.Flush()
+
+	if maxArgs := cmdMaxArgs[cmd]; len(cmdArgs) > maxArgs {
+		glog.Errorf("unexpected arguments for command %v: %v", cmd, strings.Join(cmdArgs[maxArgs:], " "))
+		return exitInvalidArgs
+	}
+
+	policy, err := loadSanitizePolicy()
+	if err != nil {
+		glog.Errorf("failed to load sanitize policy: %v", err)
+		return exitInvalidArgs
+	}
+	userSanitizePolicy = policy
+
+	if podMutation, err = loadPodMutation(); err != nil {
+		glog.Errorf("failed to parse changes to the pod copy: %v", err)
+		return exitInvalidArgs
+	}
+
+	//direct is only for pods without a parent, whose strategy is not chosen; the parent would create an extra replica
+	switch moveStrategy {
+	case "", mvUtil.StrategySchedulerSwap, mvUtil.StrategyOrphan, mvUtil.StrategyScale:
+	default:
+		glog.Errorf("unsupported strategy %v for pods with a parent: should be %v, %v or %v.", moveStrategy,
+			mvUtil.StrategySchedulerSwap, mvUtil.StrategyOrphan, mvUtil.StrategyScale)
+		return exitInvalidArgs
+	}
+
+	//the replacement of the orphan strategy is created by the parent from its template, not from a copy
+	if moveStrategy == mvUtil.StrategyOrphan &&
+		(podMutation != nil || sanitizePolicyFile != "" || stripFields != "" || keepFields != "") {
+		glog.Errorf("the pod copy cannot be changed with strategy %v: the replacement is created from the template of the parent.", moveStrategy)
+		return exitInvalidArgs
+	}
+
+	gracePolicy = buildGracePolicy()
+
+	//a long-running mode would fail every move on a read-only or unwritable backup dir
+	if backupDir != "" && (cmd == cmdServe || cmd == cmdController || cmd == cmdReconcile) {
+		if err := mvUtil.CheckBackupDir(backupDir); err != nil {
+			glog.Errorf("%v; give a writable --backupDir, or an empty one to disable backup.", err)
+			return exitBackupFailed
+		}
+	}
+
+	kubeClient, err := mvUtil.GetKubeClient(buildClientOptions())
+	if err != nil {
+		glog.Errorf("failed to get a k8s client for masterUrl=[%v], kubeConfig=[%v], context=[%v]: %v",
+			masterUrl, kubeConfig, kubeContext, err)
+		return exitClientFailed
+	}
+
+	if recordEvents {
+		eventRecorder = mvUtil.NewEventRecorder(kubeClient)
+		//events are sent in background, give them a chance to be sent before exit.
+		defer time.Sleep(eventFlushWait)
+	}
+
+	switch cmd {
+	case cmdMove:
+		return runMove(kubeClient)
+	case cmdResize:
+		return runResize(kubeClient)
+	case cmdAnalyze:
+		return runAnalyze(kubeClient)
+	case cmdExplain:
+		return runExplain(kubeClient)
+	case cmdRestore:
+		return runRestore(kubeClient)
+	case cmdServe:
+		return runServer(kubeClient)
+	case cmdController:
+		return runController(kubeClient)
+	case cmdReconcile:
+		return runReconciler(kubeClient)
+	default:
+		glog.Errorf("unknown command: %v", cmd)
+		return exitInvalidArgs
+	}
+}
+
+func main() {
+	os.Exit(run())
 }
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	mvUtil "movePod/util"
+)
+
+const (
+	namespace = "movepod"
+
+	// label value for pods without parent controller
+	noneParent = "None"
+)
+
+var (
+	movesAttempted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "moves_attempted_total",
+			Help:      "Number of pod moves attempted.",
+		},
+		[]string{"parent_kind"},
+	)
+
+	movesSucceeded = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "moves_succeeded_total",
+			Help:      "Number of pod moves succeeded.",
+		},
+		[]string{"parent_kind"},
+	)
+
+	movesFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "moves_failed_total",
+			Help:      "Number of pod moves failed, by reason.",
+		},
+		[]string{"reason", "parent_kind"},
+	)
+
+	phaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "move_phase_duration_seconds",
+			Help:      "Duration of each phase of a pod move.",
+			Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 15, 20, 30, 60, 120},
+		},
+		[]string{"phase", "parent_kind"},
+	)
+
+	swappedControllers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "controllers_with_none_exist_scheduler",
+			Help:      "Number of controllers currently pointing at the none-exist scheduler.",
+		},
+	)
+
+	// the value of swappedControllers; a restore may be seen for a swap made before a restart,
+	// so it is clamped at 0 instead of going negative.
+	swappedLock  sync.Mutex
+	swappedCount int
+)
+
+func init() {
+	prometheus.MustRegister(movesAttempted)
+	prometheus.MustRegister(movesSucceeded)
+	prometheus.MustRegister(movesFailed)
+	prometheus.MustRegister(phaseDuration)
+	prometheus.MustRegister(swappedControllers)
+}
+
+func parentLabel(kind string) string {
+	if kind == "" {
+		return noneParent
+	}
+	return kind
+}
+
+// record the result of a finished move
+func ObserveMove(result *mvUtil.MoveResult) {
+	kind := parentLabel(result.ParentKind)
+
+	movesAttempted.WithLabelValues(kind).Inc()
+	switch result.Status {
+	case mvUtil.StatusSucceeded:
+		movesSucceeded.WithLabelValues(kind).Inc()
+	case mvUtil.StatusFailed:
+		movesFailed.WithLabelValues(string(result.Reason), kind).Inc()
+	}
+
+	for _, p := range result.Phases {
+		du := time.Duration(p.DurationMs) * time.Millisecond
+		phaseDuration.WithLabelValues(p.Name, kind).Observe(du.Seconds())
+	}
+}
+
+// a controller's scheduler is changed to the none-exist scheduler
+func IncSwappedControllers() {
+	swappedLock.Lock()
+	defer swappedLock.Unlock()
+	swappedCount++
+	swappedControllers.Set(float64(swappedCount))
+}
+
+// a controller's scheduler is restored
+func DecSwappedControllers() {
+	swappedLock.Lock()
+	defer swappedLock.Unlock()
+	if swappedCount > 0 {
+		swappedCount--
+	}
+	swappedControllers.Set(float64(swappedCount))
+}
+
+// serve the metrics on addr (e.g., ":8081") at /metrics, in background
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		glog.V(2).Infof("serving metrics on %v/metrics", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			glog.Errorf("metrics server stopped: %v", err)
+		}
+	}()
+}
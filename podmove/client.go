@@ -0,0 +1,96 @@
+package podmove
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	GroupName = "movepod.io"
+	Version   = "v1alpha1"
+	Resource  = "podmoves"
+)
+
+var (
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+
+	scheme = runtime.NewScheme()
+	codecs = serializer.NewCodecFactory(scheme)
+)
+
+func init() {
+	scheme.AddKnownTypes(SchemeGroupVersion, &PodMove{}, &PodMoveList{})
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+}
+
+// create a REST client for the PodMove resource, which is defined by deploy/podmove-crd.yaml
+func NewRESTClient(cfg *restclient.Config) (*restclient.RESTClient, error) {
+	config := *cfg
+	config.GroupVersion = &SchemeGroupVersion
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: codecs}
+
+	return restclient.RESTClientFor(&config)
+}
+
+// PodMoveClient manipulates the PodMoves in a namespace
+type PodMoveClient struct {
+	client    *restclient.RESTClient
+	nameSpace string
+}
+
+func NewPodMoveClient(client *restclient.RESTClient, nameSpace string) *PodMoveClient {
+	return &PodMoveClient{
+		client:    client,
+		nameSpace: nameSpace,
+	}
+}
+
+func (c *PodMoveClient) Get(name string) (*PodMove, error) {
+	result := &PodMove{}
+	err := c.client.Get().
+		Namespace(c.nameSpace).
+		Resource(Resource).
+		Name(name).
+		Do().
+		Into(result)
+	return result, err
+}
+
+func (c *PodMoveClient) List(opts metav1.ListOptions) (*PodMoveList, error) {
+	result := &PodMoveList{}
+	err := c.client.Get().
+		Namespace(c.nameSpace).
+		Resource(Resource).
+		VersionedParams(&opts, metav1.ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+func (c *PodMoveClient) Create(obj *PodMove) (*PodMove, error) {
+	result := &PodMove{}
+	err := c.client.Post().
+		Namespace(c.nameSpace).
+		Resource(Resource).
+		Body(obj).
+		Do().
+		Into(result)
+	return result, err
+}
+
+func (c *PodMoveClient) Update(obj *PodMove) (*PodMove, error) {
+	result := &PodMove{}
+	err := c.client.Put().
+		Namespace(c.nameSpace).
+		Resource(Resource).
+		Name(obj.Name).
+		Body(obj).
+		Do().
+		Into(result)
+	return result, err
+}
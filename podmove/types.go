@@ -0,0 +1,130 @@
+package podmove
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+// PodMovePhase is the step of the move that the reconciler is working on.
+type PodMovePhase string
+
+const (
+	PhasePending            PodMovePhase = ""
+	PhaseSwappingScheduler  PodMovePhase = "SwappingScheduler"
+	PhaseDeleting           PodMovePhase = "Deleting"
+	PhaseCreating           PodMovePhase = "Creating"
+	PhaseWaitingReady       PodMovePhase = "WaitingReady"
+	PhaseRestoringScheduler PodMovePhase = "RestoringScheduler"
+	PhaseSucceeded          PodMovePhase = "Succeeded"
+	PhaseFailed             PodMovePhase = "Failed"
+)
+
+// condition types of a PodMove
+const (
+	ConditionSchedulerSwapped = "SchedulerSwapped"
+	ConditionPodDeleted       = "PodDeleted"
+	ConditionPodCreated       = "PodCreated"
+	ConditionPodReady         = "PodReady"
+	ConditionComplete         = "Complete"
+)
+
+// PodMove is a request to move a pod to another node.
+type PodMove struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PodMoveSpec   `json:"spec"`
+	Status PodMoveStatus `json:"status,omitempty"`
+}
+
+type PodMoveSpec struct {
+	// the pod to be moved; its namespace is the namespace of the PodMove if empty
+	PodRef PodReference `json:"podRef"`
+
+	// the destination node
+	TargetNode string `json:"targetNode"`
+
+	// how to move the pod; chosen by the parent of the pod if empty
+	Strategy string `json:"strategy,omitempty"`
+
+	// the move fails if the pod is not ready on the target node within this duration; no timeout if 0
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+}
+
+type PodReference struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// PodMoveStatus records the progress of the move, so that the move can be resumed after a restart.
+type PodMoveStatus struct {
+	Phase      PodMovePhase       `json:"phase,omitempty"`
+	Conditions []PodMoveCondition `json:"conditions,omitempty"`
+	Timings    []PhaseTiming      `json:"timings,omitempty"`
+	Reason     string             `json:"reason,omitempty"`
+	Error      string             `json:"error,omitempty"`
+
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	Strategy   string `json:"strategy,omitempty"`
+	SourceNode string `json:"sourceNode,omitempty"`
+	ParentKind string `json:"parentKind,omitempty"`
+	ParentName string `json:"parentName,omitempty"`
+
+	// the scheduler of the parent before it is swapped, to be restored
+	OriginalScheduler string `json:"originalScheduler,omitempty"`
+	// the UID of the original pod, so that the new pod can be told apart
+	OriginalPodUID types.UID `json:"originalPodUID,omitempty"`
+	// the pod to be created, saved before the original pod is deleted
+	PodCopy *api.Pod `json:"podCopy,omitempty"`
+}
+
+type PodMoveCondition struct {
+	Type               string              `json:"type"`
+	Status             api.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time         `json:"lastTransitionTime,omitempty"`
+	Reason             string              `json:"reason,omitempty"`
+	Message            string              `json:"message,omitempty"`
+}
+
+type PhaseTiming struct {
+	Phase PodMovePhase `json:"phase"`
+	Start metav1.Time  `json:"start"`
+	End   metav1.Time  `json:"end"`
+}
+
+type PodMoveList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []PodMove `json:"items"`
+}
+
+// whether the move is finished
+func (p *PodMove) IsFinished() bool {
+	return p.Status.Phase == PhaseSucceeded || p.Status.Phase == PhaseFailed
+}
+
+// set a condition, replacing the existing one of the same type
+func (s *PodMoveStatus) SetCondition(ctype string, status api.ConditionStatus, reason, message string) {
+	cond := PodMoveCondition{
+		Type:               ctype,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == ctype {
+			if s.Conditions[i].Status == status {
+				cond.LastTransitionTime = s.Conditions[i].LastTransitionTime
+			}
+			s.Conditions[i] = cond
+			return
+		}
+	}
+	s.Conditions = append(s.Conditions, cond)
+}
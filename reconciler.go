@@ -0,0 +1,728 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"movePod/metrics"
+	"movePod/podmove"
+	mvUtil "movePod/util"
+)
+
+const (
+	reconcileResync   = time.Minute * 5
+	reconcilePollWait = time.Second * 2
+)
+
+// podMoveReconciler drives each PodMove through its phases, one step at a time.
+// The progress is persisted in the status after every step, so that a move can be resumed after a restart.
+type podMoveReconciler struct {
+	client     *kubernetes.Clientset
+	restClient *restclient.RESTClient
+	store      cache.Store
+	informer   cache.Controller
+	queue      workqueue.RateLimitingInterface
+}
+
+func newPodMoveReconciler(client *kubernetes.Clientset, restClient *restclient.RESTClient, nameSpace string) *podMoveReconciler {
+	r := &podMoveReconciler{
+		client:     client,
+		restClient: restClient,
+		queue:      workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+
+	lw := cache.NewListWatchFromClient(restClient, podmove.Resource, nameSpace, fields.Everything())
+	r.store, r.informer = cache.NewInformer(lw, &podmove.PodMove{}, reconcileResync,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: r.enqueue,
+			UpdateFunc: func(old, cur interface{}) {
+				r.enqueue(cur)
+			},
+			DeleteFunc: r.release,
+		})
+
+	return r
+}
+
+func (r *podMoveReconciler) enqueue(obj interface{}) {
+	pm, ok := obj.(*podmove.PodMove)
+	if !ok || pm.IsFinished() {
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("failed to get key of PodMove: %v", err)
+		return
+	}
+	r.queue.Add(key)
+}
+
+// release the parent held by a PodMove deleted in the middle of the move
+func (r *podMoveReconciler) release(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pm, ok := obj.(*podmove.PodMove)
+	if !ok || pm.Status.ParentKind == "" {
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(pm)
+	if err != nil {
+		return
+	}
+	parentLocks.UnlockOwner(parentKey(podNameSpace(pm), pm.Status.ParentKind, pm.Status.ParentName), key)
+}
+
+func (r *podMoveReconciler) Run(workers int, stop <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer r.queue.ShutDown()
+
+	go r.informer.Run(stop)
+	if !cache.WaitForCacheSync(stop, r.informer.HasSynced) {
+		glog.Errorf("failed to sync the PodMove cache")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.worker(stop)
+		}()
+	}
+
+	<-stop
+	//stop taking new items, and wait for the in-flight ones
+	r.queue.ShutDown()
+	wg.Wait()
+}
+
+func (r *podMoveReconciler) worker(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if !r.processNextItem() {
+			return
+		}
+	}
+}
+
+func (r *podMoveReconciler) processNextItem() bool {
+	key, quit := r.queue.Get()
+	if quit {
+		return false
+	}
+	defer r.queue.Done(key)
+
+	after, err := r.sync(key.(string))
+	if err != nil {
+		glog.Warningf("failed to reconcile PodMove %v, will retry: %v", key, err)
+		r.queue.AddRateLimited(key)
+		return true
+	}
+
+	r.queue.Forget(key)
+	if after > 0 {
+		r.queue.AddAfter(key, after)
+	}
+	return true
+}
+
+// execute one step of the PodMove, and persist the status;
+// return how long to wait before the next step, 0 if the move is finished.
+func (r *podMoveReconciler) sync(key string) (time.Duration, error) {
+	nameSpace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	pmClient := podmove.NewPodMoveClient(r.restClient, nameSpace)
+	pm, err := pmClient.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if pm.IsFinished() {
+		return 0, nil
+	}
+
+	//the moves swapping the scheduler of the same parent are serialized, from saving the original scheduler to restoring it
+	lockKey := ""
+	if pm.Status.Strategy == mvUtil.StrategySchedulerSwap && pm.Status.Phase != podmove.PhasePending {
+		lockKey = parentKey(podNameSpace(pm), pm.Status.ParentKind, pm.Status.ParentName)
+		if !schedulerTouched(pm) && r.parentBusy(pm) || !parentLocks.TryLock(lockKey, key) {
+			glog.V(3).Infof("PodMove %v waits for the other move of %v %v", key, pm.Status.ParentKind, pm.Status.ParentName)
+			return reconcilePollWait, nil
+		}
+	}
+
+	phase := pm.Status.Phase
+	after, err := r.step(pm)
+	if err != nil {
+		return 0, err
+	}
+
+	if pm.Status.Phase != phase {
+		glog.V(2).Infof("PodMove %v: %v -> %v", key, phaseName(phase), pm.Status.Phase)
+		recordTiming(pm, phase)
+	}
+	if pm.IsFinished() {
+		r.finish(pm)
+		after = 0
+	} else if after <= 0 {
+		after = time.Millisecond
+	}
+
+	if _, err := pmClient.Update(pm); err != nil {
+		return 0, err
+	}
+	if lockKey != "" && pm.IsFinished() {
+		parentLocks.Unlock(lockKey)
+	}
+	return after, nil
+}
+
+// whether another unfinished PodMove has touched the scheduler of the same parent, e.g. one resumed after a restart,
+// which does not hold the lock of the parent until its next step.
+func (r *podMoveReconciler) parentBusy(pm *podmove.PodMove) bool {
+	for _, obj := range r.store.List() {
+		other, ok := obj.(*podmove.PodMove)
+		if !ok || other.IsFinished() || (other.Namespace == pm.Namespace && other.Name == pm.Name) {
+			continue
+		}
+		if podNameSpace(other) == podNameSpace(pm) && other.Status.ParentKind == pm.Status.ParentKind &&
+			other.Status.ParentName == pm.Status.ParentName && schedulerTouched(other) {
+			return true
+		}
+	}
+	return false
+}
+
+func phaseName(phase podmove.PodMovePhase) string {
+	if phase == podmove.PhasePending {
+		return "Pending"
+	}
+	return string(phase)
+}
+
+// record the timing of the phase which is just finished
+func recordTiming(pm *podmove.PodMove, phase podmove.PodMovePhase) {
+	now := metav1.Now()
+	start := now
+	if n := len(pm.Status.Timings); n > 0 {
+		start = pm.Status.Timings[n-1].End
+	} else if pm.Status.StartTime != nil {
+		start = *pm.Status.StartTime
+	}
+
+	pm.Status.Timings = append(pm.Status.Timings, podmove.PhaseTiming{
+		Phase: podmove.PodMovePhase(phaseName(phase)),
+		Start: start,
+		End:   now,
+	})
+}
+
+func (r *podMoveReconciler) finish(pm *podmove.PodMove) {
+	now := metav1.Now()
+	pm.Status.CompletionTime = &now
+
+	status := v1.ConditionTrue
+	result := mvUtil.StatusSucceeded
+	if pm.Status.Phase == podmove.PhaseFailed {
+		status = v1.ConditionFalse
+		result = mvUtil.StatusFailed
+	}
+	pm.Status.SetCondition(podmove.ConditionComplete, status, pm.Status.Reason, pm.Status.Error)
+
+	mresult := &mvUtil.MoveResult{
+		Pod:             fmt.Sprintf("%v/%v", podNameSpace(pm), pm.Spec.PodRef.Name),
+		SourceNode:      pm.Status.SourceNode,
+		DestinationNode: pm.Spec.TargetNode,
+		ParentKind:      pm.Status.ParentKind,
+		ParentName:      pm.Status.ParentName,
+		Strategy:        pm.Status.Strategy,
+		Status:          result,
+		Reason:          mvUtil.ErrorReason(pm.Status.Reason),
+		Error:           pm.Status.Error,
+	}
+	for _, t := range pm.Status.Timings {
+		mresult.Phases = append(mresult.Phases, mvUtil.PhaseTiming{
+			Name:       string(t.Phase),
+			Start:      t.Start.Time,
+			DurationMs: int64(t.End.Sub(t.Start.Time) / time.Millisecond),
+		})
+	}
+	metrics.ObserveMove(mresult)
+}
+
+func podNameSpace(pm *podmove.PodMove) string {
+	if pm.Spec.PodRef.Namespace != "" {
+		return pm.Spec.PodRef.Namespace
+	}
+	return pm.Namespace
+}
+
+// whether the scheduler of the parent may have been changed, so it has to be restored
+func schedulerTouched(pm *podmove.PodMove) bool {
+	return hasCondition(pm, podmove.ConditionSchedulerSwapped)
+}
+
+// whether the condition is recorded, whatever its status
+func hasCondition(pm *podmove.PodMove, ctype string) bool {
+	for _, c := range pm.Status.Conditions {
+		if c.Type == ctype {
+			return true
+		}
+	}
+	return false
+}
+
+// mark the move as failed; the scheduler of the parent is restored before it is finished.
+func failMove(pm *podmove.PodMove, err error) {
+	glog.Errorf("PodMove %v/%v failed: %v", pm.Namespace, pm.Name, err)
+	pm.Status.Reason = string(mvUtil.ReasonForError(err))
+	pm.Status.Error = err.Error()
+
+	if schedulerTouched(pm) {
+		pm.Status.Phase = podmove.PhaseRestoringScheduler
+		return
+	}
+	pm.Status.Phase = podmove.PhaseFailed
+}
+
+// whether the whole move has exceeded spec.timeoutSeconds
+func isTimeout(pm *podmove.PodMove) bool {
+	if pm.Spec.TimeoutSeconds <= 0 || pm.Status.StartTime == nil {
+		return false
+	}
+	return time.Since(pm.Status.StartTime.Time) > time.Duration(pm.Spec.TimeoutSeconds)*time.Second
+}
+
+// get the reference of the parent for recording events; nil if it is not available
+func (r *podMoveReconciler) parentReference(pm *podmove.PodMove) *v1.ObjectReference {
+	ref, err := mvUtil.GetControllerReference(r.client, podNameSpace(pm), pm.Status.ParentKind, pm.Status.ParentName)
+	if err != nil {
+		glog.Warningf("cannot get reference of %v %v: %v", pm.Status.ParentKind, pm.Status.ParentName, err)
+		return nil
+	}
+	return ref
+}
+
+// execute the step of the current phase
+func (r *podMoveReconciler) step(pm *podmove.PodMove) (time.Duration, error) {
+	switch pm.Status.Phase {
+	case podmove.PhasePending:
+		return r.start(pm)
+	case podmove.PhaseSwappingScheduler:
+		return r.swapScheduler(pm)
+	case podmove.PhaseDeleting:
+		return r.deletePod(pm)
+	case podmove.PhaseCreating:
+		return r.createPod(pm)
+	case podmove.PhaseWaitingReady:
+		return r.waitReady(pm)
+	case podmove.PhaseRestoringScheduler:
+		return r.restoreScheduler(pm)
+	}
+
+	failMove(pm, fmt.Errorf("unknown phase: %v", pm.Status.Phase))
+	return 0, nil
+}
+
+// get the pod, find its parent, and save the copy to be created.
+func (r *podMoveReconciler) start(pm *podmove.PodMove) (time.Duration, error) {
+	if pm.Status.StartTime == nil {
+		now := metav1.Now()
+		pm.Status.StartTime = &now
+	}
+
+	nameSpace := podNameSpace(pm)
+	pod, err := r.client.CoreV1().Pods(nameSpace).Get(pm.Spec.PodRef.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonGetPodFailed, "pod %v/%v not found", nameSpace, pm.Spec.PodRef.Name))
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if pod.Spec.NodeName == pm.Spec.TargetNode {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonAlreadyOnNode, "pod %v/%v is already on node: %v",
+			nameSpace, pod.Name, pm.Spec.TargetNode))
+		return 0, nil
+	}
+
+	parentKind, parentName, err := mvUtil.ParseParentInfo(pod)
+	if err != nil {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonInvalidParent, "cannot get parent info: %v", err))
+		return 0, nil
+	}
+
+	strategy := pm.Spec.Strategy
+	if strategy == "" {
+		strategy = mvUtil.StrategyDirect
+		if parentKind != "" {
+			strategy = mvUtil.StrategySchedulerSwap
+		}
+	}
+	if strategy != mvUtil.StrategyDirect && strategy != mvUtil.StrategySchedulerSwap {
+		failMove(pm, fmt.Errorf("unsupported strategy: %v", strategy))
+		return 0, nil
+	}
+	if strategy == mvUtil.StrategyDirect && parentKind != "" {
+		failMove(pm, fmt.Errorf("strategy %v cannot be used for pods with parent %v", strategy, parentKind))
+		return 0, nil
+	}
+
+	if checkPermissions {
+		req := &mvUtil.PermissionRequest{NameSpace: nameSpace, ParentKind: parentKind, Strategy: strategy,
+			CheckRollout: rolloutCheck != rolloutIgnore, HighVersion: isHighVersion()}
+		if err := mvUtil.PreflightPermissions(r.client, req); err != nil {
+			failMove(pm, err)
+			return 0, nil
+		}
+	}
+
+	//the Deployment is not paused here, as the move may be resumed by another process
+	if parentKind == "ReplicaSet" && rolloutCheck != rolloutIgnore {
+		if _, err := mvUtil.CheckRollout(r.client, nameSpace, parentName); err != nil {
+			if rolloutCheck == rolloutWait && mvUtil.ReasonForError(err) == mvUtil.ReasonRolloutInProgress &&
+				time.Since(pm.Status.StartTime.Time) < rolloutTimeout {
+				glog.V(3).Infof("PodMove %v/%v waits for rollout: %v", pm.Namespace, pm.Name, err)
+				return reconcilePollWait, nil
+			}
+			failMove(pm, rolloutError(err))
+			return 0, nil
+		}
+	}
+
+	npod, err := mvUtil.ClonePodForMove(pod, pm.Spec.TargetNode, buildSanitizePolicy())
+	if err != nil {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonInvalidInput, "failed to copy pod: %v", err))
+		return 0, nil
+	}
+	if err := podMutation.Apply(npod); err != nil {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonInvalidInput, "failed to mutate the pod copy: %v", err))
+		return 0, nil
+	}
+	if backupDir != "" {
+		if _, err := mvUtil.BackupPod(backupDir, pod, npod); err != nil {
+			failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonBackupFailed, "failed to backup pod: %v", err))
+			return 0, nil
+		}
+	}
+
+	pm.Status.Strategy = strategy
+	pm.Status.SourceNode = pod.Spec.NodeName
+	pm.Status.ParentKind = parentKind
+	pm.Status.ParentName = parentName
+	pm.Status.OriginalPodUID = pod.UID
+	pm.Status.PodCopy = npod
+
+	pm.Status.Phase = podmove.PhaseDeleting
+	if strategy == mvUtil.StrategySchedulerSwap {
+		pm.Status.Phase = podmove.PhaseSwappingScheduler
+	}
+	return time.Millisecond, nil
+}
+
+// the original scheduler is persisted first, and then the scheduler is swapped in the next step;
+// so that it can always be restored, even if we crash in the middle.
+func (r *podMoveReconciler) swapScheduler(pm *podmove.PodMove) (time.Duration, error) {
+	helper, err := mvUtil.NewMoveHelper(r.client, podNameSpace(pm), pm.Spec.PodRef.Name,
+		pm.Status.ParentKind, pm.Status.ParentName, noexistSchedulerName, isHighVersion())
+	if err != nil {
+		failMove(pm, err)
+		return time.Millisecond, nil
+	}
+
+	if !schedulerTouched(pm) {
+		current, err := helper.GetCurrentScheduler()
+		if err != nil {
+			return 0, err
+		}
+		if current == noexistSchedulerName {
+			failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed,
+				"%v %v is being used by another move", pm.Status.ParentKind, pm.Status.ParentName))
+			return 0, nil
+		}
+
+		pm.Status.OriginalScheduler = current
+		pm.Status.SetCondition(podmove.ConditionSchedulerSwapped, v1.ConditionFalse, "Swapping",
+			fmt.Sprintf("original scheduler is [%v]", current))
+		return time.Millisecond, nil
+	}
+
+	if isTimeout(pm) {
+		failMove(pm, fmt.Errorf("timeout before the scheduler is swapped"))
+		return time.Millisecond, nil
+	}
+
+	prev, err := helper.UpdateScheduler(noexistSchedulerName, defaultRetryLess)
+	if err != nil {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed, "failed to update scheduler: %v", err))
+		return time.Millisecond, nil
+	}
+	//changed by others since it was saved; what they set is what has to be restored
+	if prev != pm.Status.OriginalScheduler {
+		glog.Warningf("PodMove %v/%v: scheduler of %v %v was changed from [%v] to [%v] by others",
+			pm.Namespace, pm.Name, pm.Status.ParentKind, pm.Status.ParentName, pm.Status.OriginalScheduler, prev)
+		pm.Status.OriginalScheduler = prev
+		if prev == noexistSchedulerName {
+			//another process is moving a pod of the parent; leave the scheduler to it to restore
+			failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed,
+				"%v %v is being used by another move", pm.Status.ParentKind, pm.Status.ParentName))
+			return time.Millisecond, nil
+		}
+	}
+	if flag, err := helper.CheckScheduler(noexistSchedulerName, 1); err != nil || !flag {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonSchedulerUpdateFailed, "failed to check scheduler."))
+		return time.Millisecond, nil
+	}
+
+	metrics.IncSwappedControllers()
+	recordParentEvent(r.parentReference(pm), v1.EventTypeNormal, mvUtil.EventSchedulerSwapped,
+		"Changed scheduler from [%v] to [%v] for moving pod %v to node %v",
+		pm.Status.OriginalScheduler, noexistSchedulerName, pm.Spec.PodRef.Name, pm.Spec.TargetNode)
+	pm.Status.SetCondition(podmove.ConditionSchedulerSwapped, v1.ConditionTrue, "Swapped",
+		fmt.Sprintf("scheduler changed from [%v] to [%v]", pm.Status.OriginalScheduler, noexistSchedulerName))
+	pm.Status.Phase = podmove.PhaseDeleting
+	return time.Millisecond, nil
+}
+
+func (r *podMoveReconciler) deletePod(pm *podmove.PodMove) (time.Duration, error) {
+	nameSpace := podNameSpace(pm)
+	pod, err := r.client.CoreV1().Pods(nameSpace).Get(pm.Spec.PodRef.Name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return 0, err
+	}
+
+	//the delete is recorded before it is sent, so that a pod gone or replaced after a restart
+	//can be told from a pod deleted or replaced by others.
+	deleting := hasCondition(pm, podmove.ConditionPodDeleted)
+	gone := err != nil || pod.UID != pm.Status.OriginalPodUID
+	if gone && !deleting {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonPodChanged,
+			"pod %v/%v was deleted or replaced by others before the move deleted it", nameSpace, pm.Spec.PodRef.Name))
+		return time.Millisecond, nil
+	}
+
+	//already deleted before a restart
+	if gone || pod.DeletionTimestamp != nil {
+		pm.Status.SetCondition(podmove.ConditionPodDeleted, v1.ConditionTrue, "Deleted", "")
+		pm.Status.Phase = podmove.PhaseCreating
+		return time.Millisecond, nil
+	}
+
+	if !deleting {
+		pm.Status.SetCondition(podmove.ConditionPodDeleted, v1.ConditionFalse, "Deleting", "")
+		return time.Millisecond, nil
+	}
+
+	if isTimeout(pm) {
+		failMove(pm, fmt.Errorf("timeout before the pod is deleted"))
+		return time.Millisecond, nil
+	}
+
+	if err := mvUtil.DeleteOriginalPod(r.client, pod, pm.Spec.TargetNode, buildMoveOptions(nil)); err != nil {
+		failMove(pm, err)
+		return time.Millisecond, nil
+	}
+
+	pm.Status.SetCondition(podmove.ConditionPodDeleted, v1.ConditionTrue, "Deleted", "")
+	pm.Status.Phase = podmove.PhaseCreating
+	return time.Second, nil
+}
+
+func (r *podMoveReconciler) createPod(pm *podmove.PodMove) (time.Duration, error) {
+	nameSpace := podNameSpace(pm)
+	pod, err := r.client.CoreV1().Pods(nameSpace).Get(pm.Spec.PodRef.Name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return 0, err
+	}
+
+	if err == nil {
+		//the original pod is still terminating; report what keeps it, e.g. finalizers
+		if pod.UID == pm.Status.OriginalPodUID {
+			blocker := mvUtil.DescribeTermination(pod)
+			if terminationTimeout > 0 && pod.DeletionTimestamp != nil && time.Since(pod.DeletionTimestamp.Time) > terminationTimeout {
+				failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonTerminationTimeout,
+					"pod %v/%v is still terminating after %v: %v", nameSpace, pod.Name, terminationTimeout, blocker))
+				return time.Millisecond, nil
+			}
+			if isTimeout(pm) {
+				failMove(pm, fmt.Errorf("timeout before the pod is created: %v", blocker))
+				return time.Millisecond, nil
+			}
+			pm.Status.SetCondition(podmove.ConditionPodCreated, v1.ConditionFalse, "WaitingTermination", blocker)
+			return reconcilePollWait, nil
+		}
+
+		//created before a restart
+		if pod.Spec.NodeName == pm.Spec.TargetNode {
+			pm.Status.SetCondition(podmove.ConditionPodCreated, v1.ConditionTrue, "Created", "")
+			pm.Status.Phase = podmove.PhaseWaitingReady
+			return time.Millisecond, nil
+		}
+
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonPodChanged,
+			"pod %v/%v was replaced by another pod (uid %v) on node %v while terminating", nameSpace, pod.Name, pod.UID, pod.Spec.NodeName))
+		return time.Millisecond, nil
+	}
+
+	if isTimeout(pm) {
+		failMove(pm, fmt.Errorf("timeout before the pod is created"))
+		return time.Millisecond, nil
+	}
+
+	if pm.Status.PodCopy == nil {
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonCreateFailed, "no copy of the pod is saved"))
+		return time.Millisecond, nil
+	}
+
+	if _, err := mvUtil.CreatePodCopy(r.client, pm.Status.PodCopy, pm.Status.SourceNode, buildMoveOptions(nil)); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return reconcilePollWait, nil
+		}
+		if r.queue.NumRequeues(pm.Namespace+"/"+pm.Name) < controllerMaxRetries {
+			return 0, err
+		}
+		failMove(pm, mvUtil.NewMoveError(mvUtil.ReasonCreateFailed, "failed to create new pod: %v", err))
+		return time.Millisecond, nil
+	}
+
+	pm.Status.SetCondition(podmove.ConditionPodCreated, v1.ConditionTrue, "Created", "")
+	pm.Status.Phase = podmove.PhaseWaitingReady
+	return reconcilePollWait, nil
+}
+
+func (r *podMoveReconciler) waitReady(pm *podmove.PodMove) (time.Duration, error) {
+	nameSpace := podNameSpace(pm)
+	_, err := mvUtil.ProbePodMoveHealth(r.client, nameSpace, pm.Spec.PodRef.Name, pm.Spec.TargetNode)
+	if err == nil {
+		pm.Status.SetCondition(podmove.ConditionPodReady, v1.ConditionTrue, "Running", "")
+		pm.Status.Phase = podmove.PhaseSucceeded
+		if schedulerTouched(pm) {
+			pm.Status.Phase = podmove.PhaseRestoringScheduler
+		}
+		return time.Millisecond, nil
+	}
+
+	//without spec.timeoutSeconds, wait for healthTimeout after the pod is created
+	timeout := isTimeout(pm)
+	if pm.Spec.TimeoutSeconds <= 0 {
+		for _, c := range pm.Status.Conditions {
+			if c.Type == podmove.ConditionPodCreated && time.Since(c.LastTransitionTime.Time) > healthTimeout {
+				timeout = true
+			}
+		}
+	}
+
+	if timeout {
+		pm.Status.SetCondition(podmove.ConditionPodReady, v1.ConditionFalse, "Timeout", err.Error())
+		failMove(pm, err)
+		return time.Millisecond, nil
+	}
+	return reconcilePollWait, nil
+}
+
+func (r *podMoveReconciler) restoreScheduler(pm *podmove.PodMove) (time.Duration, error) {
+	helper, err := mvUtil.NewMoveHelper(r.client, podNameSpace(pm), pm.Spec.PodRef.Name,
+		pm.Status.ParentKind, pm.Status.ParentName, noexistSchedulerName, isHighVersion())
+	if err != nil {
+		failMove(pm, err)
+		pm.Status.Phase = podmove.PhaseFailed
+		return 0, nil
+	}
+
+	swapped := false
+	for _, c := range pm.Status.Conditions {
+		if c.Type == podmove.ConditionSchedulerSwapped && c.Status == v1.ConditionTrue {
+			swapped = true
+		}
+	}
+
+	//the scheduler is left to the other move using the parent
+	if pm.Status.OriginalScheduler == noexistSchedulerName {
+		pm.Status.SetCondition(podmove.ConditionSchedulerSwapped, v1.ConditionFalse, "LeftToOthers",
+			fmt.Sprintf("scheduler is [%v] of another move", noexistSchedulerName))
+		pm.Status.Phase = podmove.PhaseFailed
+		return 0, nil
+	}
+
+	helper.SetScheduler(pm.Status.OriginalScheduler)
+	restored, err := helper.CleanUp()
+	if err != nil {
+		if r.queue.NumRequeues(pm.Namespace+"/"+pm.Name) < controllerMaxRetries {
+			return 0, err
+		}
+		pm.Status.Reason = string(mvUtil.ReasonSchedulerRestoreFailed)
+		pm.Status.Error = err.Error()
+		pm.Status.Phase = podmove.PhaseFailed
+		return 0, nil
+	}
+
+	if swapped {
+		metrics.DecSwappedControllers()
+	}
+	if restored {
+		recordParentEvent(r.parentReference(pm), v1.EventTypeNormal, mvUtil.EventSchedulerRestored,
+			"Restored scheduler to [%v] after moving pod %v", pm.Status.OriginalScheduler, pm.Spec.PodRef.Name)
+	}
+	mvUtil.CleanPendingPod(r.client, podNameSpace(pm), noexistSchedulerName,
+		pm.Status.ParentKind, pm.Status.ParentName, isHighVersion())
+
+	pm.Status.SetCondition(podmove.ConditionSchedulerSwapped, v1.ConditionFalse, "Restored",
+		fmt.Sprintf("scheduler restored to [%v]", pm.Status.OriginalScheduler))
+
+	pm.Status.Phase = podmove.PhaseSucceeded
+	if pm.Status.Error != "" {
+		pm.Status.Phase = podmove.PhaseFailed
+	}
+	return 0, nil
+}
+
+// run in reconciler mode: drive the PodMove resources in nameSpace (all namespaces if empty).
+func runReconciler(kubeClient *kubernetes.Clientset) int {
+	config, err := mvUtil.GetKubeConfig(buildClientOptions())
+	if err != nil {
+		glog.Errorf("failed to get kube config: %v", err)
+		return exitClientFailed
+	}
+
+	restClient, err := podmove.NewRESTClient(config)
+	if err != nil {
+		glog.Errorf("failed to create PodMove client: %v", err)
+		return exitClientFailed
+	}
+
+	startMetricsServer()
+
+	return runLeaderElected(kubeClient, func(stop <-chan struct{}) {
+		glog.V(2).Infof("reconciling PodMoves in namespace [%v]", watchNameSpace)
+		r := newPodMoveReconciler(kubeClient, restClient, watchNameSpace)
+		r.Run(serverWorkers, stop)
+	})
+}
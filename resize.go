@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"movePod/metrics"
+	mvUtil "movePod/util"
+)
+
+// change the requests/limits of a pod by re-creating it with the Copy-Delete-Create move,
+// on the same node, or on destNode if it is given.
+// The template of the parent is not touched, and the scheduler of the parent is swapped as in a move,
+// so the replacement pod created by the parent is never scheduled, and is cleaned up afterwards.
+func resizePod(client *kubernetes.Clientset, nameSpace, podName, destNode string, opts *mvUtil.MoveOptions) (string, error) {
+	id := fmt.Sprintf("%v/%v", nameSpace, podName)
+
+	pod, err := client.CoreV1().Pods(nameSpace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		merr := mvUtil.NewMoveError(mvUtil.ReasonGetPodFailed, "resize-aborted: get original pod:%v\n%v", id, err.Error())
+		glog.Error(merr.Error())
+		return "", merr
+	}
+
+	if pod.Spec.NodeName == "" && destNode == "" {
+		merr := mvUtil.NewMoveError(mvUtil.ReasonInvalidInput, "resize-aborted: pod %v is not scheduled yet, give the node by --nodeName", id)
+		glog.Error(merr.Error())
+		return "", merr
+	}
+	nodeName := pod.Spec.NodeName
+	if destNode != "" {
+		nodeName = destNode
+	}
+
+	//the original pod is deleted before the resized one is created, so it has to fit without the original
+	if err := checkResizedPodFits(client, pod, nodeName, opts); err != nil {
+		glog.Error(err.Error())
+		return "", err
+	}
+
+	glog.V(2).Infof("resize-pod: begin to resize %v on node %v", id, nodeName)
+	opts.Trace.SetDestination(nodeName)
+	return nodeName, moveParentedPod(client, pod, nodeName, opts)
+}
+
+// check the requests of the resized copy against the allocatable resources of the node,
+// leaving out the original pod if it is on the node.
+func checkResizedPodFits(client *kubernetes.Clientset, pod *v1.Pod, nodeName string, opts *mvUtil.MoveOptions) error {
+	id := fmt.Sprintf("%v/%v", pod.Namespace, pod.Name)
+
+	npod, err := mvUtil.ClonePodForMove(pod, nodeName, buildSanitizePolicy())
+	if err != nil {
+		return mvUtil.NewMoveError(mvUtil.ReasonInvalidInput, "resize-aborted: failed to copy pod-%v: %v", id, err)
+	}
+	if err := opts.Mutation.Apply(npod); err != nil {
+		return mvUtil.NewMoveError(mvUtil.ReasonInvalidInput, "resize-aborted: failed to mutate the copy of pod-%v: %v", id, err)
+	}
+
+	node, err := client.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return mvUtil.NewMoveError(mvUtil.ReasonGetNodeFailed, "resize-aborted: failed to get node %v: %v", nodeName, err)
+	}
+
+	excluded := types.UID("")
+	if pod.Spec.NodeName == nodeName {
+		excluded = pod.UID
+	}
+	if fit := mvUtil.CheckNodeResourcesFit(client, npod, node, excluded); !fit.Passed {
+		return mvUtil.NewMoveError(mvUtil.ReasonInsufficientResources,
+			"resize-aborted: pod-%v with the new resources does not fit node %v: %v", id, nodeName, fit.Message)
+	}
+	return nil
+}
+
+func runResize(kubeClient *kubernetes.Clientset) int {
+	if podMutation == nil || (len(podMutation.Requests) == 0 && len(podMutation.Limits) == 0) {
+		glog.Errorf("requests or limits should be given for resize.")
+		return exitInvalidArgs
+	}
+	if moveStrategy != "" && moveStrategy != mvUtil.StrategySchedulerSwap {
+		glog.Errorf("strategy %v cannot be used for resize: the pod should be re-created with its own name.", moveStrategy)
+		return exitInvalidArgs
+	}
+
+	id := fmt.Sprintf("%v/%v", nameSpace, podName)
+	trace := mvUtil.NewMoveTrace(id, "")
+	opts := buildMoveOptions(trace)
+
+	node, err := resizePod(kubeClient, nameSpace, podName, nodeName, opts)
+	if err == nil {
+		//the pod may be re-created with a generated name, if the original one is stuck in terminating
+		name := podName
+		if result := trace.Result(); result.NewPod != "" {
+			name = result.NewPod
+		}
+		err = checkMovedPod(kubeClient, nameSpace, name, node, opts)
+	}
+	trace.Finish(err)
+
+	result := trace.Result()
+	metrics.ObserveMove(&result)
+	if outputFormat == outputJSON {
+		printResult(trace)
+	}
+
+	if err != nil {
+		glog.Errorf("resize pod %v failed: %v", id, err)
+	}
+	return exitCodeForError(err)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/client-go/kubernetes"
+
+	mvUtil "movePod/util"
+)
+
+// how a rollout in progress of the Deployment is handled
+const (
+	rolloutRefuse = "refuse"
+	rolloutWait   = "wait"
+	rolloutIgnore = "ignore"
+)
+
+// check the rollout of the Deployment owning the ReplicaSet, and pause the Deployment if pauseDeployment is set.
+// Return the function to resume the Deployment after the move; it is never nil.
+func guardRollout(client *kubernetes.Clientset, nameSpace, parentKind, parentName string, trace *mvUtil.MoveTrace) (func(), error) {
+	nop := func() {}
+	if parentKind != "ReplicaSet" || (rolloutCheck == rolloutIgnore && !pauseDeployment) {
+		return nop, nil
+	}
+
+	var deployName string
+	switch rolloutCheck {
+	case rolloutIgnore:
+		deploy, _, err := mvUtil.GetReplicaSetDeployment(client, nameSpace, parentName)
+		if err != nil {
+			return nop, mvUtil.NewMoveError(mvUtil.ReasonInvalidParent, "move-aborted: cannot get Deployment of ReplicaSet %v: %v", parentName, err)
+		}
+		if deploy != nil {
+			deployName = deploy.Name
+		}
+	case rolloutWait:
+		glog.V(2).Infof("wait at most %v for the rollout of ReplicaSet %v/%v", rolloutTimeout, nameSpace, parentName)
+		deploy, err := mvUtil.WaitRollout(client, nameSpace, parentName, rolloutTimeout)
+		if err != nil {
+			return nop, rolloutError(err)
+		}
+		if deploy != nil {
+			deployName = deploy.Name
+		}
+	default:
+		deploy, err := mvUtil.CheckRollout(client, nameSpace, parentName)
+		if err != nil {
+			return nop, rolloutError(err)
+		}
+		if deploy != nil {
+			deployName = deploy.Name
+		}
+	}
+
+	if deployName == "" || !pauseDeployment {
+		return nop, nil
+	}
+
+	paused, err := mvUtil.SetDeploymentPaused(client, nameSpace, deployName, true)
+	if err != nil {
+		return nop, mvUtil.NewMoveError(mvUtil.ReasonRolloutInProgress, "move-aborted: failed to pause Deployment %v/%v: %v", nameSpace, deployName, err)
+	}
+	if paused {
+		//paused by someone else; leave it as it is
+		return nop, nil
+	}
+	glog.V(2).Infof("paused Deployment %v/%v during the move", nameSpace, deployName)
+
+	return func() {
+		if _, err := mvUtil.SetDeploymentPaused(client, nameSpace, deployName, false); err != nil {
+			glog.Errorf("failed to resume Deployment %v/%v: %v", nameSpace, deployName, err)
+			return
+		}
+		trace.AddCleanup(fmt.Sprintf("resumed Deployment %v/%v", nameSpace, deployName))
+	}, nil
+}
+
+func rolloutError(err error) error {
+	if mvUtil.ReasonForError(err) == mvUtil.ReasonRolloutInProgress {
+		return mvUtil.NewMoveError(mvUtil.ReasonRolloutInProgress, "move-aborted: %v", err)
+	}
+	return mvUtil.NewMoveError(mvUtil.ReasonInvalidParent, "move-aborted: cannot check the rollout: %v", err)
+}
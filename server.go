@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/client-go/kubernetes"
+
+	"movePod/metrics"
+	mvUtil "movePod/util"
+)
+
+// states of a move operation in server mode
+const (
+	opQueued    = "Queued"
+	opRunning   = "Running"
+	opSucceeded = "Succeeded"
+	opFailed    = "Failed"
+	opCancelled = "Cancelled"
+
+	movesPath = "/moves"
+
+	serverQueueSize   = 100
+	serverOpRetention = time.Hour
+)
+
+type moveRequest struct {
+	NameSpace string `json:"namespace"`
+	PodName   string `json:"pod"`
+	NodeName  string `json:"node"`
+}
+
+// a move operation submitted by the REST API
+type moveOperation struct {
+	ID      string            `json:"id"`
+	Request moveRequest       `json:"request"`
+	State   string            `json:"state"`
+	Created time.Time         `json:"created"`
+	Result  mvUtil.MoveResult `json:"result"`
+
+	trace  *mvUtil.MoveTrace
+	cancel chan struct{}
+}
+
+// moveServer executes the move requests by a pool of workers, reusing one client.
+type moveServer struct {
+	client *kubernetes.Clientset
+
+	lock    sync.Mutex
+	seq     int
+	ops     map[string]*moveOperation
+	queue   chan *moveOperation
+	leading bool
+}
+
+func newMoveServer(client *kubernetes.Clientset, queueSize int) *moveServer {
+	return &moveServer{
+		client: client,
+		ops:    make(map[string]*moveOperation),
+		queue:  make(chan *moveOperation, queueSize),
+	}
+}
+
+// execute the submitted moves until stop is closed;
+// then the queued operations are cancelled, and the running ones are cancelled if their pods are not deleted yet, or waited.
+func (s *moveServer) Run(workers int, stop <-chan struct{}) {
+	s.setLeading(true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.worker(stop)
+		}()
+	}
+
+	<-stop
+	s.setLeading(false)
+	s.cancelAll()
+	wg.Wait()
+}
+
+func (s *moveServer) setLeading(leading bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.leading = leading
+}
+
+func (s *moveServer) isLeading() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.leading
+}
+
+// cancel the operations which are not finished yet; a running one stops only if its pod is not deleted yet.
+func (s *moveServer) cancelAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, op := range s.ops {
+		switch op.State {
+		case opQueued:
+			op.State = opCancelled
+			close(op.cancel)
+			op.trace.Finish(mvUtil.NewMoveError(mvUtil.ReasonCancelled, "cancelled before started: server stopped"))
+		case opRunning:
+			select {
+			case <-op.cancel:
+			default:
+				close(op.cancel)
+			}
+		}
+	}
+}
+
+func (s *moveServer) worker(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case op := <-s.queue:
+			s.execute(op)
+		}
+	}
+}
+
+func (s *moveServer) execute(op *moveOperation) {
+	if !s.setState(op, opQueued, opRunning) {
+		glog.V(3).Infof("skip move operation %v: %v", op.ID, op.State)
+		return
+	}
+
+	req := op.Request
+	opts := buildMoveOptions(op.trace)
+	opts.Cancel = op.cancel
+
+	err := moveAndCheck(s.client, req.NameSpace, req.PodName, req.NodeName, opts)
+	op.trace.Finish(err)
+
+	result := op.trace.Result()
+	metrics.ObserveMove(&result)
+
+	state := opSucceeded
+	if mvUtil.ReasonForError(err) == mvUtil.ReasonCancelled {
+		state = opCancelled
+	} else if err != nil {
+		state = opFailed
+	}
+	s.setState(op, opRunning, state)
+}
+
+// change the state of op if its current state is from
+func (s *moveServer) setState(op *moveOperation, from, to string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if op.State != from {
+		return false
+	}
+	op.State = to
+	return true
+}
+
+func (s *moveServer) submit(req moveRequest) (*moveOperation, error) {
+	if req.NameSpace == "" {
+		req.NameSpace = "default"
+	}
+	if req.PodName == "" || req.NodeName == "" {
+		return nil, fmt.Errorf("pod and node should not be empty")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pruneOps()
+	for _, op := range s.ops {
+		if op.Request.NameSpace == req.NameSpace && op.Request.PodName == req.PodName &&
+			(op.State == opQueued || op.State == opRunning) {
+			return nil, fmt.Errorf("pod %v/%v is being moved by operation %v", req.NameSpace, req.PodName, op.ID)
+		}
+	}
+
+	s.seq++
+	op := &moveOperation{
+		ID:      fmt.Sprintf("move-%d", s.seq),
+		Request: req,
+		State:   opQueued,
+		Created: time.Now(),
+		trace:   mvUtil.NewMoveTrace(fmt.Sprintf("%v/%v", req.NameSpace, req.PodName), req.NodeName),
+		cancel:  make(chan struct{}),
+	}
+
+	select {
+	case s.queue <- op:
+	default:
+		return nil, fmt.Errorf("too many pending operations")
+	}
+
+	s.ops[op.ID] = op
+	return op, nil
+}
+
+// forget the finished operations which are too old
+func (s *moveServer) pruneOps() {
+	for id, op := range s.ops {
+		if op.State == opQueued || op.State == opRunning {
+			continue
+		}
+		if time.Since(op.Created) > serverOpRetention {
+			delete(s.ops, id)
+		}
+	}
+}
+
+// cancel a queued or running operation; a running operation can only be cancelled before the pod is deleted.
+func (s *moveServer) cancelOp(id string) (*moveOperation, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	op, ok := s.ops[id]
+	if !ok {
+		return nil, nil
+	}
+
+	switch op.State {
+	case opQueued:
+		op.State = opCancelled
+		close(op.cancel)
+		op.trace.Finish(mvUtil.NewMoveError(mvUtil.ReasonCancelled, "cancelled before started"))
+	case opRunning:
+		select {
+		case <-op.cancel:
+		default:
+			close(op.cancel)
+		}
+	default:
+		return op, fmt.Errorf("operation %v is already %v", id, op.State)
+	}
+
+	return op, nil
+}
+
+// get a copy of the operation, with its current result.
+func (s *moveServer) snapshot(op *moveOperation) *moveOperation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return &moveOperation{
+		ID:      op.ID,
+		Request: op.Request,
+		State:   op.State,
+		Created: op.Created,
+		Result:  op.trace.Result(),
+	}
+}
+
+func (s *moveServer) get(id string) *moveOperation {
+	s.lock.Lock()
+	op, ok := s.ops[id]
+	s.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.snapshot(op)
+}
+
+func (s *moveServer) list() []*moveOperation {
+	s.lock.Lock()
+	ops := make([]*moveOperation, 0, len(s.ops))
+	for _, op := range s.ops {
+		ops = append(ops, op)
+	}
+	s.lock.Unlock()
+
+	result := make([]*moveOperation, 0, len(ops))
+	for _, op := range ops {
+		result = append(result, s.snapshot(op))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.Before(result[j].Created)
+	})
+	return result
+}
+
+// parentLocker serializes the moves of the pods of the same parent in this process:
+// concurrent scheduler swaps on one parent would save the none-exist scheduler as the original one.
+type parentLocker struct {
+	lock sync.Mutex
+	busy map[string]chan struct{}
+
+	// the holders taking the lock by TryLock, e.g. the PodMoves, which hold it across several steps
+	owners map[string]string
+}
+
+var parentLocks = &parentLocker{busy: make(map[string]chan struct{}), owners: make(map[string]string)}
+
+func parentKey(nameSpace, kind, name string) string {
+	return fmt.Sprintf("%v/%v/%v", kind, nameSpace, name)
+}
+
+// wait until no other move is using the parent, and take it; return false if cancelled while waiting.
+func (l *parentLocker) Lock(key string, cancel <-chan struct{}) bool {
+	for {
+		l.lock.Lock()
+		done, ok := l.busy[key]
+		if !ok {
+			l.busy[key] = make(chan struct{})
+			l.lock.Unlock()
+			return true
+		}
+		l.lock.Unlock()
+
+		glog.V(3).Infof("waiting for the move using %v to finish", key)
+		select {
+		case <-done:
+		case <-cancel:
+			return false
+		}
+	}
+}
+
+// take the parent for owner without waiting; return true if it is taken, or already held by owner.
+func (l *parentLocker) TryLock(key, owner string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.busy[key]; ok {
+		return l.owners[key] == owner
+	}
+	l.busy[key] = make(chan struct{})
+	l.owners[key] = owner
+	return true
+}
+
+// release the parent if it is held by owner
+func (l *parentLocker) UnlockOwner(key, owner string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if holder, ok := l.owners[key]; !ok || holder != owner {
+		return
+	}
+	l.unlock(key)
+}
+
+func (l *parentLocker) Unlock(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.unlock(key)
+}
+
+func (l *parentLocker) unlock(key string) {
+	if done, ok := l.busy[key]; ok {
+		close(done)
+		delete(l.busy, key)
+		delete(l.owners, key)
+	}
+}
+
+//---------------REST API---------------
+// POST   /moves       submit a move: {"namespace": "default", "pod": "mypod", "node": "node1"}
+// GET    /moves       list the operations
+// GET    /moves/<id>  get the status of an operation
+// DELETE /moves/<id>  cancel an operation
+
+func (s *moveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, movesPath), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		s.handleSubmit(w, r)
+	case id == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.list())
+	case id != "" && r.Method == http.MethodGet:
+		op := s.get(id)
+		if op == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("operation %v not found", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, op)
+	case id != "" && r.Method == http.MethodDelete:
+		op, err := s.cancelOp(id)
+		if op == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("operation %v not found", id))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, s.snapshot(op))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("unsupported request: %v %v", r.Method, r.URL.Path))
+	}
+}
+
+func (s *moveServer) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if !s.isLeading() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("not the leader, submit to the leader instance"))
+		return
+	}
+
+	req := moveRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	op, err := s.submit(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	glog.V(2).Infof("accepted move operation %v: %v/%v to %v", op.ID, req.NameSpace, req.PodName, req.NodeName)
+	writeJSON(w, http.StatusAccepted, s.snapshot(op))
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		glog.Errorf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// run in server mode: accept move requests by REST API until the process is killed.
+// with leader election, every instance serves the API, but only the leader accepts new moves.
+func runServer(kubeClient *kubernetes.Clientset) int {
+	startMetricsServer()
+
+	server := newMoveServer(kubeClient, serverQueueSize)
+
+	mux := http.NewServeMux()
+	mux.Handle(movesPath, server)
+	mux.Handle(movesPath+"/", server)
+
+	go func() {
+		glog.V(2).Infof("serving move API on %v%v with %d workers", listenAddr, movesPath, serverWorkers)
+		if err := http.ListenAndServe(listenAddr, mux); err != nil {
+			glog.Fatalf("server stopped: %v", err)
+		}
+	}()
+
+	return runLeaderElected(kubeClient, func(stop <-chan struct{}) {
+		server.Run(serverWorkers, stop)
+	})
+}
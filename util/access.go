@@ -0,0 +1,190 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	kclient "k8s.io/client-go/kubernetes"
+	authv1 "k8s.io/client-go/pkg/apis/authorization/v1"
+	authv1beta1 "k8s.io/client-go/pkg/apis/authorization/v1beta1"
+)
+
+// a permission needed by the move
+type Permission struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	NameSpace   string
+}
+
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Subresource != "" {
+		resource = resource + "/" + p.Subresource
+	}
+	if p.Group != "" {
+		resource = resource + "." + p.Group
+	}
+	return fmt.Sprintf("%v %v in namespace %v", p.Verb, resource, p.NameSpace)
+}
+
+// what the move is going to do, to decide the permissions it needs
+type PermissionRequest struct {
+	NameSpace string
+
+	//kind of the parent controller; empty for a standalone pod
+	ParentKind string
+
+	//the move strategy; decided by ParentKind if empty
+	Strategy string
+
+	//the Deployment of a ReplicaSet parent is read for the rollout check, and updated to pause it
+	CheckRollout    bool
+	PauseDeployment bool
+
+	//whether the cluster serves authorization/v1 (k8s >= 1.6); authorization/v1beta1 is used otherwise
+	HighVersion bool
+}
+
+// the resource of the parent controller, whose scheduler is swapped
+var parentResources = map[string]Permission{
+	kindReplicationController: {Group: "", Resource: "replicationcontrollers"},
+	kindReplicaSet:            {Group: "extensions", Resource: "replicasets"},
+}
+
+// list the permissions needed for the move
+func MovePermissions(req *PermissionRequest) []Permission {
+	ns := req.NameSpace
+	perms := []Permission{
+		{Verb: "get", Resource: "pods", NameSpace: ns},
+		{Verb: "create", Resource: "pods", NameSpace: ns},
+		{Verb: "delete", Resource: "pods", NameSpace: ns},
+	}
+
+	if req.ParentKind == "" {
+		return perms
+	}
+
+	//the scheduler of the parent is swapped, and the pending pods created meanwhile are cleaned
+	verbs := []string{"get", "update"}
+	if req.Strategy == StrategyOrphan {
+		//the pod is relabeled, and the replacement created by the parent is bound
+		perms = append(perms,
+			Permission{Verb: "patch", Resource: "pods", NameSpace: ns},
+			Permission{Verb: "create", Resource: "pods", Subresource: "binding", NameSpace: ns})
+	}
+
+	perms = append(perms, Permission{Verb: "list", Resource: "pods", NameSpace: ns})
+	if parent, ok := parentResources[req.ParentKind]; ok {
+		for _, verb := range verbs {
+			perm := parent
+			perm.Verb = verb
+			perm.NameSpace = ns
+			perms = append(perms, perm)
+		}
+
+		//the replicas are changed by the scale subresource of the extensions group
+		if req.Strategy == StrategyScale {
+			for _, verb := range []string{"get", "update"} {
+				perms = append(perms, Permission{Verb: verb, Group: "extensions", Resource: parent.Resource,
+					Subresource: "scale", NameSpace: ns})
+			}
+		}
+	}
+
+	if req.ParentKind == kindReplicaSet {
+		if req.CheckRollout || req.PauseDeployment {
+			perms = append(perms, Permission{Verb: "get", Group: "extensions", Resource: "deployments", NameSpace: ns})
+		}
+		if req.PauseDeployment {
+			perms = append(perms, Permission{Verb: "update", Group: "extensions", Resource: "deployments", NameSpace: ns})
+		}
+	}
+
+	return perms
+}
+
+// review the permission by authorization/v1 (k8s >= 1.6) or authorization/v1beta1; return whether it is allowed, and why.
+func reviewPermission(client *kclient.Clientset, perm Permission, highver bool) (bool, string, error) {
+	if !highver {
+		review := &authv1beta1.SelfSubjectAccessReview{
+			Spec: authv1beta1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authv1beta1.ResourceAttributes{
+					Namespace:   perm.NameSpace,
+					Verb:        perm.Verb,
+					Group:       perm.Group,
+					Resource:    perm.Resource,
+					Subresource: perm.Subresource,
+				},
+			},
+		}
+		result, err := client.AuthorizationV1beta1().SelfSubjectAccessReviews().Create(review)
+		if err != nil {
+			return false, "", err
+		}
+		return result.Status.Allowed, result.Status.Reason, nil
+	}
+
+	review := &authv1.SelfSubjectAccessReview{
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace:   perm.NameSpace,
+				Verb:        perm.Verb,
+				Group:       perm.Group,
+				Resource:    perm.Resource,
+				Subresource: perm.Subresource,
+			},
+		},
+	}
+	result, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(review)
+	if err != nil {
+		return false, "", err
+	}
+	return result.Status.Allowed, result.Status.Reason, nil
+}
+
+// review the permissions by SelfSubjectAccessReview; return the ones which are not allowed.
+// If the apiserver does not serve SelfSubjectAccessReview, the check is skipped with a warning.
+func CheckPermissions(client *kclient.Clientset, perms []Permission, highver bool) ([]Permission, error) {
+	missing := []Permission{}
+
+	for _, perm := range perms {
+		allowed, reason, err := reviewPermission(client, perm, highver)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				glog.Warningf("SelfSubjectAccessReview is not served by the apiserver, skip the permission check: %v", err)
+				return []Permission{}, nil
+			}
+			return nil, fmt.Errorf("failed to review permission [%v]: %v", perm, err)
+		}
+
+		if !allowed {
+			glog.V(3).Infof("permission [%v] is not allowed: %v", perm, reason)
+			missing = append(missing, perm)
+		}
+	}
+
+	return missing, nil
+}
+
+// check all the permissions needed for the move, before changing anything.
+func PreflightPermissions(client *kclient.Clientset, req *PermissionRequest) error {
+	missing, err := CheckPermissions(client, MovePermissions(req), req.HighVersion)
+	if err != nil {
+		return NewMoveError(ReasonPermissionDenied, "move-aborted: %v", err)
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for _, perm := range missing {
+			names = append(names, perm.String())
+		}
+		return NewMoveError(ReasonPermissionDenied, "move-aborted: missing permissions: %v", strings.Join(names, "; "))
+	}
+
+	return nil
+}
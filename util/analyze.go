@@ -0,0 +1,212 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kclient "k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+	policyv1beta1 "k8s.io/client-go/pkg/apis/policy/v1beta1"
+)
+
+// why a pod cannot be moved
+const (
+	UnmovableMirrorPod         = "MirrorPod"
+	UnmovableDaemonSet         = "DaemonSet"
+	UnmovableUnsupportedParent = "UnsupportedParent"
+	UnmovableInvalidParent     = "InvalidParent"
+	UnmovableLocalVolume       = "LocalPersistentVolume"
+	UnmovableHostPath          = "HostPath"
+	UnmovablePDB               = "DisruptionBudget"
+	UnmovableTerminating       = "Terminating"
+	UnmovableCompleted         = "Completed"
+	UnmovableNotScheduled      = "NotScheduled"
+
+	// the annotation the kubelet sets on the mirror of a static pod
+	mirrorPodAnnotationKey = "kubernetes.io/config.mirror"
+	// the alpha annotation binding a PersistentVolume to nodes (k8s 1.7)
+	volumeNodeAffinityAnnotationKey = "volume.alpha.kubernetes.io/node-affinity"
+)
+
+// UnmovableReason is a reason why a pod cannot be moved.
+type UnmovableReason struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Movability is the verdict of the analysis of a pod.
+type Movability struct {
+	NameSpace  string            `json:"namespace"`
+	Pod        string            `json:"pod"`
+	Node       string            `json:"node"`
+	ParentKind string            `json:"parentKind,omitempty"`
+	ParentName string            `json:"parentName,omitempty"`
+	Movable    bool              `json:"movable"`
+	Reasons    []UnmovableReason `json:"reasons"`
+}
+
+func (m *Movability) addReason(reason, format string, a ...interface{}) {
+	m.Movable = false
+	m.Reasons = append(m.Reasons, UnmovableReason{Reason: reason, Message: fmt.Sprintf(format, a...)})
+}
+
+// whether movePod can move the pods of the parent; empty kind is for standalone pods.
+func IsSupportedParent(kind string) bool {
+	return kind == "" || kind == kindReplicationController || kind == kindReplicaSet
+}
+
+// PodAnalyzer tells whether the pods can be moved, by the same checks as the move.
+// The PodDisruptionBudgets and the PersistentVolumes are cached, so it is for one scan only.
+type PodAnalyzer struct {
+	client *kclient.Clientset
+
+	// PodDisruptionBudgets of each namespace
+	pdbs map[string][]policyv1beta1.PodDisruptionBudget
+	// whether the PersistentVolume is bound to a node
+	localVolumes map[string]bool
+}
+
+func NewPodAnalyzer(client *kclient.Clientset) *PodAnalyzer {
+	return &PodAnalyzer{
+		client:       client,
+		pdbs:         make(map[string][]policyv1beta1.PodDisruptionBudget),
+		localVolumes: make(map[string]bool),
+	}
+}
+
+// analyze the pods of the namespace; all the namespaces if nameSpace is empty.
+func (a *PodAnalyzer) AnalyzeNameSpace(nameSpace string) ([]*Movability, error) {
+	pods, err := a.client.CoreV1().Pods(nameSpace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Movability, 0, len(pods.Items))
+	for i := range pods.Items {
+		result = append(result, a.Analyze(&(pods.Items[i])))
+	}
+	return result, nil
+}
+
+// analyze the pod; all the reasons are reported, not only the first one.
+func (a *PodAnalyzer) Analyze(pod *api.Pod) *Movability {
+	m := &Movability{
+		NameSpace: pod.Namespace,
+		Pod:       pod.Name,
+		Node:      pod.Spec.NodeName,
+		Movable:   true,
+		Reasons:   []UnmovableReason{},
+	}
+
+	if _, ok := pod.Annotations[mirrorPodAnnotationKey]; ok {
+		m.addReason(UnmovableMirrorPod, "mirror of a static pod on node %v", pod.Spec.NodeName)
+	}
+	if pod.DeletionTimestamp != nil {
+		m.addReason(UnmovableTerminating, "pod is being deleted since %v", pod.DeletionTimestamp.Time)
+	}
+	if pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed {
+		m.addReason(UnmovableCompleted, "pod is %v", pod.Status.Phase)
+	} else if pod.Spec.NodeName == "" {
+		m.addReason(UnmovableNotScheduled, "pod is not scheduled yet")
+	}
+
+	parentKind, parentName, err := ParseParentInfo(pod)
+	if err != nil {
+		m.addReason(UnmovableInvalidParent, "cannot get parent info: %v", err)
+	}
+	m.ParentKind = parentKind
+	m.ParentName = parentName
+	switch {
+	case parentKind == kindDaemonSet:
+		m.addReason(UnmovableDaemonSet, "pod of DaemonSet %v runs on every node", parentName)
+	case !IsSupportedParent(parentKind):
+		m.addReason(UnmovableUnsupportedParent, "unsupported kind: %v", parentKind)
+	}
+
+	a.checkVolumes(pod, m)
+	a.checkDisruptionBudgets(pod, m)
+	return m
+}
+
+// the pod cannot leave its node with a hostPath volume, or a PersistentVolume bound to the node
+func (a *PodAnalyzer) checkVolumes(pod *api.Pod, m *Movability) {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.HostPath != nil {
+			m.addReason(UnmovableHostPath, "volume %v is hostPath %v", vol.Name, vol.HostPath.Path)
+			continue
+		}
+		if vol.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claim := vol.PersistentVolumeClaim.ClaimName
+		pvc, err := a.client.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(claim, metav1.GetOptions{})
+		if err != nil {
+			glog.Warningf("failed to get PersistentVolumeClaim %v/%v: %v", pod.Namespace, claim, err)
+			continue
+		}
+		pvName := pvc.Spec.VolumeName
+		if pvName == "" {
+			continue
+		}
+
+		local, err := a.isLocalVolume(pvName)
+		if err != nil {
+			glog.Warningf("failed to get PersistentVolume %v: %v", pvName, err)
+			continue
+		}
+		if local {
+			m.addReason(UnmovableLocalVolume, "volume %v is bound to local PersistentVolume %v", vol.Name, pvName)
+		}
+	}
+}
+
+func (a *PodAnalyzer) isLocalVolume(name string) (bool, error) {
+	if local, ok := a.localVolumes[name]; ok {
+		return local, nil
+	}
+
+	pv, err := a.client.CoreV1().PersistentVolumes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	//a local PersistentVolume (spec.local, k8s 1.7) is not known by the vendored client-go,
+	//but it is bound to its node by the node affinity annotation
+	_, affinity := pv.Annotations[volumeNodeAffinityAnnotationKey]
+	local := pv.Spec.HostPath != nil || affinity
+	a.localVolumes[name] = local
+	return local, nil
+}
+
+// the pod cannot be deleted if a PodDisruptionBudget covering it allows no disruption
+func (a *PodAnalyzer) checkDisruptionBudgets(pod *api.Pod, m *Movability) {
+	pdbs, ok := a.pdbs[pod.Namespace]
+	if !ok {
+		list, err := a.client.PolicyV1beta1().PodDisruptionBudgets(pod.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			glog.Warningf("failed to list PodDisruptionBudgets of namespace %v: %v", pod.Namespace, err)
+			return
+		}
+		pdbs = list.Items
+		a.pdbs[pod.Namespace] = pdbs
+	}
+
+	for i := range pdbs {
+		pdb := &(pdbs[i])
+		if pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if pdb.Status.PodDisruptionsAllowed <= 0 {
+			m.addReason(UnmovablePDB, "PodDisruptionBudget %v allows no disruption (%d of %d desired healthy pods)",
+				pdb.Name, pdb.Status.CurrentHealthy, pdb.Status.DesiredHealthy)
+		}
+	}
+}
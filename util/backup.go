@@ -0,0 +1,128 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+// PodBackup is what is saved to local disk before the original pod is deleted:
+// the original pod, and the copy that is going to be created.
+type PodBackup struct {
+	Time     metav1.Time `json:"time"`
+	Original *api.Pod    `json:"original"`
+	Copy     *api.Pod    `json:"copy,omitempty"`
+}
+
+// the pod may hold secrets, e.g. literal env values, so the backups are readable by the owner only
+const (
+	backupDirMode  = 0700
+	backupFileMode = 0600
+)
+
+// create dir if needed, and check that a backup can be written into it.
+func CheckBackupDir(dir string) error {
+	if err := os.MkdirAll(dir, backupDirMode); err != nil {
+		return fmt.Errorf("failed to create backup dir %v: %v", dir, err)
+	}
+
+	f, err := ioutil.TempFile(dir, ".check")
+	if err != nil {
+		return fmt.Errorf("backup dir %v is not writable: %v", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// save the original pod and its copy into dir, return the path of the backup file.
+func BackupPod(dir string, pod, npod *api.Pod) (string, error) {
+	if err := os.MkdirAll(dir, backupDirMode); err != nil {
+		return "", fmt.Errorf("failed to create backup dir %v: %v", dir, err)
+	}
+
+	now := time.Now()
+	backup := &PodBackup{
+		Time:     metav1.NewTime(now),
+		Original: pod,
+		Copy:     npod,
+	}
+
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode pod-%v/%v: %v", pod.Namespace, pod.Name, err)
+	}
+
+	fname := fmt.Sprintf("%s_%s_%s.json", pod.Namespace, pod.Name, now.Format("20060102T150405.000"))
+	fpath := filepath.Join(dir, fname)
+	if err := ioutil.WriteFile(fpath, data, backupFileMode); err != nil {
+		return "", fmt.Errorf("failed to write backup file %v: %v", fpath, err)
+	}
+
+	glog.V(2).Infof("backup pod-%v/%v to %v", pod.Namespace, pod.Name, fpath)
+	return fpath, nil
+}
+
+func LoadPodBackup(fpath string) (*PodBackup, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup file %v: %v", fpath, err)
+	}
+
+	backup := &PodBackup{}
+	if err := json.Unmarshal(data, backup); err != nil {
+		return nil, fmt.Errorf("failed to decode backup file %v: %v", fpath, err)
+	}
+
+	if backup.Original == nil {
+		return nil, fmt.Errorf("invalid backup file %v: no original pod", fpath)
+	}
+
+	return backup, nil
+}
+
+// re-create a pod from the backup file;
+// if nodeName is empty, the pod will be bound to the node recorded in the copy (the destination of the move).
+func RestorePod(client *kclient.Clientset, fpath, nodeName string) (*api.Pod, error) {
+	backup, err := LoadPodBackup(fpath)
+	if err != nil {
+		glog.Error(err)
+		return nil, err
+	}
+
+	npod := backup.Copy
+	if npod == nil {
+		npod, err = ClonePodForMove(backup.Original, backup.Original.Spec.NodeName, nil)
+		if err != nil {
+			glog.Errorf("failed to copy pod from %v: %v", fpath, err)
+			return nil, err
+		}
+	}
+	npod.ResourceVersion = ""
+	npod.UID = ""
+
+	if nodeName != "" {
+		npod.Spec.NodeName = nodeName
+	}
+
+	id := fmt.Sprintf("%v/%v", npod.Namespace, npod.Name)
+	glog.V(2).Infof("restore pod-%v onto node [%v] from %v", id, npod.Spec.NodeName, fpath)
+
+	pod, err := client.CoreV1().Pods(npod.Namespace).Create(npod)
+	if err != nil {
+		merr := NewMoveError(ReasonCreateFailed, "failed to restore pod-%v: %v", id, err)
+		glog.Error(merr)
+		return nil, merr
+	}
+
+	return pod, nil
+}
@@ -0,0 +1,136 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kclient "k8s.io/client-go/kubernetes"
+	extv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	kindDeployment = "Deployment"
+
+	revisionAnnotationKey = "deployment.kubernetes.io/revision"
+	rolloutPollInterval   = time.Second * 2
+)
+
+// get the Deployment owning the ReplicaSet; return nil if it is not owned by a Deployment.
+func GetReplicaSetDeployment(client *kclient.Clientset, nameSpace, rsName string) (*extv1beta1.Deployment, *extv1beta1.ReplicaSet, error) {
+	rs, err := client.ExtensionsV1beta1().ReplicaSets(nameSpace).Get(rsName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, owner := range rs.OwnerReferences {
+		if owner.Kind != kindDeployment || owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+
+		deploy, err := client.ExtensionsV1beta1().Deployments(nameSpace).Get(owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, rs, err
+		}
+		return deploy, rs, nil
+	}
+
+	return nil, rs, nil
+}
+
+// check whether the ReplicaSet is the current revision of the Deployment, and the rollout is complete;
+// return the Deployment, or nil if the ReplicaSet is not owned by a Deployment.
+func CheckRollout(client *kclient.Clientset, nameSpace, rsName string) (*extv1beta1.Deployment, error) {
+	deploy, rs, err := GetReplicaSetDeployment(client, nameSpace, rsName)
+	if err != nil {
+		return nil, err
+	}
+	if deploy == nil {
+		return nil, nil
+	}
+
+	id := fmt.Sprintf("%v/%v", nameSpace, deploy.Name)
+	revision := deploy.Annotations[revisionAnnotationKey]
+	if rs.Annotations[revisionAnnotationKey] != revision {
+		return deploy, NewMoveError(ReasonRolloutInProgress, "ReplicaSet %v is revision [%v], not the current revision [%v] of Deployment %v",
+			rsName, rs.Annotations[revisionAnnotationKey], revision, id)
+	}
+
+	if msg := rolloutProgress(deploy); msg != "" {
+		return deploy, NewMoveError(ReasonRolloutInProgress, "rollout of Deployment %v is in progress: %v", id, msg)
+	}
+
+	return deploy, nil
+}
+
+// describe why the rollout is not complete, in the way of "kubectl rollout status"; empty if it is complete.
+func rolloutProgress(deploy *extv1beta1.Deployment) string {
+	if deploy.Status.ObservedGeneration < deploy.Generation {
+		return "waiting for the spec update to be observed"
+	}
+
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+
+	status := deploy.Status
+	if status.UpdatedReplicas < replicas {
+		return fmt.Sprintf("rollout is still updating replicas (%d/%d updated)", status.UpdatedReplicas, replicas)
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas)
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas)
+	}
+	return ""
+}
+
+// wait until the rollout of the Deployment owning the ReplicaSet is complete, or timeout.
+func WaitRollout(client *kclient.Clientset, nameSpace, rsName string, timeout time.Duration) (*extv1beta1.Deployment, error) {
+	var deploy *extv1beta1.Deployment
+	var lastErr error
+
+	err := wait.Poll(rolloutPollInterval, timeout, func() (bool, error) {
+		deploy, lastErr = CheckRollout(client, nameSpace, rsName)
+		if lastErr == nil {
+			return true, nil
+		}
+		if ReasonForError(lastErr) != ReasonRolloutInProgress {
+			return false, lastErr
+		}
+		glog.V(3).Infof("wait for rollout: %v", lastErr)
+		return false, nil
+	})
+
+	if err == wait.ErrWaitTimeout {
+		return deploy, lastErr
+	}
+	return deploy, err
+}
+
+// pause or resume the Deployment; return whether it was paused before.
+func SetDeploymentPaused(client *kclient.Clientset, nameSpace, name string, paused bool) (bool, error) {
+	previous := false
+
+	err := RetryDuring(defaultRetryLess, defaultTimeOut, defaultSleep, func() error {
+		deploy, err := client.ExtensionsV1beta1().Deployments(nameSpace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		previous = deploy.Spec.Paused
+		if previous == paused {
+			return nil
+		}
+		deploy.Spec.Paused = paused
+		_, err = client.ExtensionsV1beta1().Deployments(nameSpace).Update(deploy)
+		return err
+	})
+
+	return previous, err
+}
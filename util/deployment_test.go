@@ -0,0 +1,64 @@
+package util
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	extv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func newRolloutDeployment(generation, observed int64, replicas *int32, status extv1beta1.DeploymentStatus) *extv1beta1.Deployment {
+	status.ObservedGeneration = observed
+	return &extv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Generation: generation},
+		Spec:       extv1beta1.DeploymentSpec{Replicas: replicas},
+		Status:     status,
+	}
+}
+
+func TestRolloutProgress(t *testing.T) {
+	three := int32(3)
+
+	tests := []struct {
+		name   string
+		deploy *extv1beta1.Deployment
+		want   string
+	}{
+		{
+			name:   "complete",
+			deploy: newRolloutDeployment(2, 2, &three, extv1beta1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}),
+			want:   "",
+		},
+		{
+			name:   "spec update not observed",
+			deploy: newRolloutDeployment(3, 2, &three, extv1beta1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}),
+			want:   "waiting for the spec update to be observed",
+		},
+		{
+			name:   "updating replicas",
+			deploy: newRolloutDeployment(2, 2, &three, extv1beta1.DeploymentStatus{Replicas: 4, UpdatedReplicas: 1, AvailableReplicas: 3}),
+			want:   "rollout is still updating replicas (1/3 updated)",
+		},
+		{
+			name:   "replicas default to one",
+			deploy: newRolloutDeployment(2, 2, nil, extv1beta1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 0, AvailableReplicas: 1}),
+			want:   "rollout is still updating replicas (0/1 updated)",
+		},
+		{
+			name:   "old replicas terminating",
+			deploy: newRolloutDeployment(2, 2, &three, extv1beta1.DeploymentStatus{Replicas: 5, UpdatedReplicas: 3, AvailableReplicas: 3}),
+			want:   "2 old replicas are pending termination",
+		},
+		{
+			name:   "updated replicas not available",
+			deploy: newRolloutDeployment(2, 2, &three, extv1beta1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2}),
+			want:   "2 of 3 updated replicas are available",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := rolloutProgress(tt.deploy); got != tt.want {
+			t.Errorf("%v: rolloutProgress = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
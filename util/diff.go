@@ -0,0 +1,163 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+// kinds of the changes of a field
+const (
+	FieldAdded   = "added"
+	FieldRemoved = "removed"
+	FieldChanged = "changed"
+
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// a field which differs between the original pod and its copy
+type FieldDiff struct {
+	Path     string `json:"path"`
+	Change   string `json:"change"`
+	Original string `json:"original,omitempty"`
+	Copy     string `json:"copy,omitempty"`
+}
+
+func (d FieldDiff) String() string {
+	switch d.Change {
+	case FieldAdded:
+		return fmt.Sprintf("+ %v: %v", d.Path, d.Copy)
+	case FieldRemoved:
+		return fmt.Sprintf("- %v: %v", d.Path, d.Original)
+	}
+	return fmt.Sprintf("~ %v: %v -> %v", d.Path, d.Original, d.Copy)
+}
+
+// compare the metadata and spec of the original pod and its copy;
+// the status, which is never copied, is reported as removed as a whole.
+func DiffPod(pod, npod *api.Pod) ([]FieldDiff, error) {
+	old, err := flattenObject(pod)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := flattenObject(npod)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []FieldDiff{}
+	for path, value := range old {
+		if strings.HasPrefix(path, "status") {
+			continue
+		}
+		nvalue, ok := cur[path]
+		if !ok {
+			diffs = append(diffs, FieldDiff{Path: path, Change: FieldRemoved, Original: value})
+			continue
+		}
+		if nvalue != value {
+			diffs = append(diffs, FieldDiff{Path: path, Change: FieldChanged, Original: value, Copy: nvalue})
+		}
+	}
+	for path, value := range cur {
+		if strings.HasPrefix(path, "status") {
+			continue
+		}
+		if _, ok := old[path]; !ok {
+			diffs = append(diffs, FieldDiff{Path: path, Change: FieldAdded, Copy: value})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+
+	if pod.Status.Phase != "" {
+		diffs = append(diffs, FieldDiff{Path: "status", Change: FieldRemoved,
+			Original: fmt.Sprintf("phase=%v, podIP=%v, hostIP=%v", pod.Status.Phase, pod.Status.PodIP, pod.Status.HostIP)})
+	}
+	return diffs, nil
+}
+
+// flatten the object into "path: value" pairs, e.g. "spec.containers[0].image": "\"nginx\""
+func flattenObject(obj interface{}) (map[string]string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	flattenValue("", value, result)
+	return result, nil
+}
+
+func flattenValue(prefix string, value interface{}, result map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenValue(path, item, result)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenValue(fmt.Sprintf("%v[%d]", prefix, i), item, result)
+		}
+	default:
+		data, _ := json.Marshal(v)
+		result[prefix] = string(data)
+	}
+}
+
+// the fields of the copy which may not work as expected after the move
+func RiskyFields(pod, npod *api.Pod) []string {
+	warnings := []string{}
+
+	if pod.Spec.Hostname != npod.Spec.Hostname || pod.Spec.Subdomain != npod.Spec.Subdomain {
+		warnings = append(warnings, fmt.Sprintf("hostname/subdomain [%v/%v] is not kept, the DNS name of the pod changes",
+			pod.Spec.Hostname, pod.Spec.Subdomain))
+	}
+
+	for _, vol := range npod.Spec.Volumes {
+		if vol.Secret != nil && isServiceAccountTokenVolume(npod, vol.Name) {
+			warnings = append(warnings, fmt.Sprintf("volume %v is the auto-mounted service account token [%v], it is copied as is",
+				vol.Name, vol.Secret.SecretName))
+		}
+		if vol.Projected != nil {
+			warnings = append(warnings, fmt.Sprintf("volume %v is a projected volume, its sources are copied as is", vol.Name))
+		}
+	}
+
+	//ephemeral containers are not supported by this API version, so there is nothing to check for them.
+	return warnings
+}
+
+// whether the volume is the token of the pod's service account, which is injected by the admission controller
+func isServiceAccountTokenVolume(pod *api.Pod, volumeName string) bool {
+	sa := pod.Spec.ServiceAccountName
+	if sa == "" {
+		sa = "default"
+	}
+	if !strings.HasPrefix(volumeName, sa+"-token-") {
+		return false
+	}
+
+	for _, c := range pod.Spec.Containers {
+		for _, m := range c.VolumeMounts {
+			if m.Name == volumeName && m.MountPath == serviceAccountTokenPath {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"fmt"
+)
+
+// ErrorReason tells why a move failed, so that callers can branch on the outcome.
+type ErrorReason string
+
+const (
+	ReasonUnknown                ErrorReason = "Unknown"
+	ReasonGetPodFailed           ErrorReason = "GetPodFailed"
+	ReasonAlreadyOnNode          ErrorReason = "AlreadyOnNode"
+	ReasonInvalidParent          ErrorReason = "InvalidParent"
+	ReasonUnsupportedParent      ErrorReason = "UnsupportedParent"
+	ReasonSchedulerUpdateFailed  ErrorReason = "SchedulerUpdateFailed"
+	ReasonBackupFailed           ErrorReason = "BackupFailed"
+	ReasonDeleteFailed           ErrorReason = "DeleteFailed"
+	ReasonCreateFailed           ErrorReason = "CreateFailed"
+	ReasonHealthCheckFailed      ErrorReason = "HealthCheckFailed"
+	ReasonSchedulerRestoreFailed ErrorReason = "SchedulerRestoreFailed"
+	ReasonCancelled              ErrorReason = "Cancelled"
+	ReasonPermissionDenied       ErrorReason = "PermissionDenied"
+	ReasonOrphanFailed           ErrorReason = "OrphanFailed"
+	ReasonScaleFailed            ErrorReason = "ScaleFailed"
+	ReasonRolloutInProgress      ErrorReason = "RolloutInProgress"
+	ReasonPodChanged             ErrorReason = "PodChanged"
+	ReasonTerminationTimeout     ErrorReason = "TerminationTimeout"
+	ReasonInvalidInput           ErrorReason = "InvalidInput"
+	ReasonInsufficientResources  ErrorReason = "InsufficientResources"
+	ReasonGetNodeFailed          ErrorReason = "GetNodeFailed"
+)
+
+// MoveError is the error returned by the move operations.
+type MoveError struct {
+	Reason ErrorReason
+	Msg    string
+}
+
+func (e *MoveError) Error() string {
+	return e.Msg
+}
+
+func NewMoveError(reason ErrorReason, format string, a ...interface{}) *MoveError {
+	return &MoveError{
+		Reason: reason,
+		Msg:    fmt.Sprintf(format, a...),
+	}
+}
+
+// get the reason of the error; return ReasonUnknown if it is not a MoveError.
+func ReasonForError(err error) ErrorReason {
+	if err == nil {
+		return ""
+	}
+
+	if merr, ok := err.(*MoveError); ok {
+		return merr.Reason
+	}
+
+	return ReasonUnknown
+}
+
+func IsAlreadyOnNode(err error) bool {
+	return ReasonForError(err) == ReasonAlreadyOnNode
+}
+
+func IsUnsupportedParent(err error) bool {
+	return ReasonForError(err) == ReasonUnsupportedParent
+}
+
+func IsDeleteFailed(err error) bool {
+	return ReasonForError(err) == ReasonDeleteFailed
+}
+
+func IsCreateFailed(err error) bool {
+	return ReasonForError(err) == ReasonCreateFailed
+}
+
+func IsHealthCheckFailed(err error) bool {
+	return ReasonForError(err) == ReasonHealthCheckFailed
+}
+
+func IsSchedulerRestoreFailed(err error) bool {
+	return ReasonForError(err) == ReasonSchedulerRestoreFailed
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	api "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventComponent = "movePod"
+
+	// reasons of the events
+	EventSchedulerSwapped       = "MoveSchedulerSwapped"
+	EventSchedulerSwapFailed    = "MoveSchedulerSwapFailed"
+	EventSchedulerRestored      = "MoveSchedulerRestored"
+	EventSchedulerRestoreFailed = "MoveSchedulerRestoreFailed"
+	EventPodDeleting            = "MovePodDeleting"
+	EventPodDeleteFailed        = "MovePodDeleteFailed"
+	EventPodCreated             = "MovePodCreated"
+	EventPodCreateFailed        = "MovePodCreateFailed"
+	EventMoveSucceeded          = "MoveSucceeded"
+	EventMoveFailed             = "MoveFailed"
+	EventPodOrphaned            = "MovePodOrphaned"
+	EventPodTerminationBlocked  = "MovePodTerminationBlocked"
+)
+
+// create an EventRecorder which sends the events to the apiserver.
+func NewEventRecorder(client *kclient.Clientset) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(glog.V(3).Infof)
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, api.EventSource{Component: eventComponent})
+}
+
+// record an event if recorder is not nil
+func RecordEvent(recorder record.EventRecorder, obj runtime.Object, eventType, reason, format string, a ...interface{}) {
+	if recorder == nil || obj == nil {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, format, a...)
+}
+
+// get the reference of the parent controller, with its UID, so the events are shown by "kubectl describe"
+func GetControllerReference(client *kclient.Clientset, nameSpace, kind, name string) (*api.ObjectReference, error) {
+	var meta metav1.ObjectMeta
+	var apiVersion string
+	option := metav1.GetOptions{}
+
+	switch kind {
+	case kindReplicationController:
+		rc, err := client.CoreV1().ReplicationControllers(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, err
+		}
+		meta = rc.ObjectMeta
+		apiVersion = "v1"
+	case kindReplicaSet:
+		rs, err := client.ExtensionsV1beta1().ReplicaSets(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, err
+		}
+		meta = rs.ObjectMeta
+		apiVersion = "extensions/v1beta1"
+	default:
+		return nil, fmt.Errorf("unsupported kind: %s", kind)
+	}
+
+	return &api.ObjectReference{
+		Kind:            kind,
+		APIVersion:      apiVersion,
+		Namespace:       meta.Namespace,
+		Name:            meta.Name,
+		UID:             meta.UID,
+		ResourceVersion: meta.ResourceVersion,
+	}, nil
+}
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kclient "k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// the grace period of a pod without terminationGracePeriodSeconds, as the apiserver defaults it
+	podDeletionGracePeriodDefault int64 = 30
+
+	// the grace period 0 force-deletes the pod, without waiting for the kubelet to stop it; it is raised to this
+	podDeletionGracePeriodMin int64 = 1
+
+	// how long to wait for the kubelet to report the termination, after the grace period
+	terminationWaitMargin   = time.Second * 10
+	terminationPollInterval = time.Second
+)
+
+// GracePolicy tells the grace period to delete the original pod with; the pod's own by default.
+type GracePolicy struct {
+	// the pod's grace period is capped at this; no cap if nil
+	Max *int64
+
+	// used instead of the pod's grace period; nil to use the pod's own
+	Override *int64
+
+	// allow the grace period 0, which force-deletes the pod; it is raised to 1s otherwise
+	Force bool
+}
+
+// GracePeriod is the grace period chosen for a pod, and why.
+type GracePeriod struct {
+	Seconds int64 `json:"seconds"`
+
+	// the pod's own terminationGracePeriodSeconds, or the default if the pod has none
+	Requested  int64 `json:"requested"`
+	Default    bool  `json:"default,omitempty"`
+	Capped     bool  `json:"capped,omitempty"`
+	Overridden bool  `json:"overridden,omitempty"`
+
+	// the grace period 0 is raised to avoid a force deletion, or kept by the policy
+	Raised bool `json:"raised,omitempty"`
+	Force  bool `json:"force,omitempty"`
+}
+
+func (g *GracePeriod) String() string {
+	switch {
+	case g.Force:
+		return fmt.Sprintf("%ds, force deletion", g.Seconds)
+	case g.Raised:
+		return fmt.Sprintf("%ds, raised from 0s to avoid a force deletion", g.Seconds)
+	case g.Overridden:
+		return fmt.Sprintf("%ds, overridden by the grace policy", g.Seconds)
+	case g.Capped:
+		return fmt.Sprintf("%ds, capped from %ds", g.Seconds, g.Requested)
+	case g.Default:
+		return fmt.Sprintf("%ds, the default", g.Seconds)
+	}
+	return fmt.Sprintf("%ds, the pod's own", g.Seconds)
+}
+
+// how long to wait for the pod to be terminated after it is deleted with this grace period
+func (g *GracePeriod) TerminationTimeout() time.Duration {
+	return time.Duration(g.Seconds)*time.Second + terminationWaitMargin
+}
+
+// the grace period to delete the original pod with, by the policy; the pod's own if policy is nil.
+// The grace period 0 is raised to 1s, unless the policy allows the force deletion.
+func CalcGracePeriod(pod *api.Pod, policy *GracePolicy) *GracePeriod {
+	g := &GracePeriod{Requested: podDeletionGracePeriodDefault, Default: true}
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		g.Requested = *(pod.Spec.TerminationGracePeriodSeconds)
+		g.Default = false
+	}
+	g.Seconds = g.Requested
+
+	if policy != nil {
+		if policy.Override != nil {
+			g.Seconds = *policy.Override
+			g.Overridden = true
+		} else if policy.Max != nil && g.Seconds > *policy.Max {
+			g.Seconds = *policy.Max
+			g.Capped = true
+		}
+	}
+
+	if g.Seconds <= 0 {
+		if policy != nil && policy.Force {
+			g.Seconds = 0
+			g.Force = true
+		} else {
+			g.Seconds = podDeletionGracePeriodMin
+			g.Raised = true
+		}
+	}
+	return g
+}
+
+// wait until the pod is gone from the apiserver.
+// If it is still there after timeout, the pod as last seen is returned with the error;
+// if it is replaced by another pod with the same name, the other pod is returned with a PodChanged error.
+func WaitPodTerminated(client *kclient.Clientset, pod *api.Pod, timeout time.Duration) (*api.Pod, error) {
+	var lastErr error
+	var lingering, replaced *api.Pod
+	err := wait.Poll(terminationPollInterval, timeout, func() (bool, error) {
+		current, err := client.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			lastErr = err
+			return errors.IsNotFound(err), nil
+		}
+		lastErr = nil
+		if current.UID != pod.UID {
+			replaced = current
+			return true, nil
+		}
+		lingering = current
+		return false, nil
+	})
+
+	if err == nil && replaced != nil {
+		return replaced, NewMoveError(ReasonPodChanged, "pod %v/%v was replaced by another pod (uid %v) while terminating",
+			pod.Namespace, pod.Name, replaced.UID)
+	}
+
+	if err == wait.ErrWaitTimeout {
+		if lastErr != nil {
+			return lingering, fmt.Errorf("pod %v/%v is not known to be terminated after %v: %v", pod.Namespace, pod.Name, timeout, lastErr)
+		}
+		return lingering, fmt.Errorf("pod %v/%v is still terminating after %v: %v", pod.Namespace, pod.Name, timeout,
+			DescribeTermination(lingering))
+	}
+	return nil, err
+}
+
+// tell what keeps a deleted pod in the apiserver: its finalizers, or the kubelet not confirming the termination yet.
+func DescribeTermination(pod *api.Pod) string {
+	if pod == nil {
+		return "unknown"
+	}
+	if len(pod.Finalizers) > 0 {
+		return fmt.Sprintf("blocked by finalizers [%v]", strings.Join(pod.Finalizers, ", "))
+	}
+	if pod.DeletionTimestamp == nil {
+		return "not being deleted"
+	}
+	return fmt.Sprintf("waiting for the kubelet on node %v to confirm the termination, deleted at %v",
+		pod.Spec.NodeName, pod.DeletionTimestamp.Time)
+}
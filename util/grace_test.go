@@ -0,0 +1,103 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func TestCalcGracePeriod(t *testing.T) {
+	tests := []struct {
+		name   string
+		pod    *int64
+		policy *GracePolicy
+		want   GracePeriod
+	}{
+		{
+			name: "default of the apiserver",
+			want: GracePeriod{Seconds: 30, Requested: 30, Default: true},
+		},
+		{
+			name: "pod's own",
+			pod:  int64Ptr(60),
+			want: GracePeriod{Seconds: 60, Requested: 60},
+		},
+		{
+			name:   "empty policy",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{},
+			want:   GracePeriod{Seconds: 60, Requested: 60},
+		},
+		{
+			name:   "capped",
+			pod:    int64Ptr(600),
+			policy: &GracePolicy{Max: int64Ptr(120)},
+			want:   GracePeriod{Seconds: 120, Requested: 600, Capped: true},
+		},
+		{
+			name:   "below the cap",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{Max: int64Ptr(120)},
+			want:   GracePeriod{Seconds: 60, Requested: 60},
+		},
+		{
+			name:   "cap of the default",
+			policy: &GracePolicy{Max: int64Ptr(10)},
+			want:   GracePeriod{Seconds: 10, Requested: 30, Default: true, Capped: true},
+		},
+		{
+			name:   "overridden",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{Override: int64Ptr(300)},
+			want:   GracePeriod{Seconds: 300, Requested: 60, Overridden: true},
+		},
+		{
+			name:   "override wins over the cap",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{Override: int64Ptr(300), Max: int64Ptr(120)},
+			want:   GracePeriod{Seconds: 300, Requested: 60, Overridden: true},
+		},
+		{
+			name:   "override of 0 is raised",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{Override: int64Ptr(0)},
+			want:   GracePeriod{Seconds: 1, Requested: 60, Overridden: true, Raised: true},
+		},
+		{
+			name:   "cap of 0 is raised",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{Max: int64Ptr(0)},
+			want:   GracePeriod{Seconds: 1, Requested: 60, Capped: true, Raised: true},
+		},
+		{
+			name: "pod's own 0 is raised",
+			pod:  int64Ptr(0),
+			want: GracePeriod{Seconds: 1, Requested: 0, Raised: true},
+		},
+		{
+			name:   "override of 0 with force",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{Override: int64Ptr(0), Force: true},
+			want:   GracePeriod{Seconds: 0, Requested: 60, Overridden: true, Force: true},
+		},
+		{
+			name:   "force alone keeps the pod's own",
+			pod:    int64Ptr(60),
+			policy: &GracePolicy{Force: true},
+			want:   GracePeriod{Seconds: 60, Requested: 60},
+		},
+	}
+
+	for _, tt := range tests {
+		pod := &api.Pod{Spec: api.PodSpec{TerminationGracePeriodSeconds: tt.pod}}
+		got := CalcGracePeriod(pod, tt.policy)
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%v: CalcGracePeriod = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
@@ -6,36 +6,65 @@ import (
 	"github.com/golang/glog"
 	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kclient "k8s.io/client-go/kubernetes"
 	api "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
 	kindReplicationController     = "ReplicationController"
 	kindReplicaSet                = "ReplicaSet"
 
-	podDeletionGracePeriodDefault int64 = 10
-	podDeletionGracePeriodMax     int64 = 10
 	defaultSleep                        = time.Second * 3
 	defaultTimeOut                      = time.Second * 10
 	defaultRetryLess                    = 2
 	defaultRetryMore                    = 4
 )
 
-func calcGracePeriod(pod *api.Pod) int64 {
-	grace := podDeletionGracePeriodDefault
-	if pod.Spec.TerminationGracePeriodSeconds != nil {
-		grace = *(pod.Spec.TerminationGracePeriodSeconds)
-		if grace > podDeletionGracePeriodMax {
-			grace = podDeletionGracePeriodMax
-		}
+// options of the Copy-Delete-Create move
+type MoveOptions struct {
+	RetryNum int
+
+	//directory to save the original and copied pods before deletion; no backup if empty
+	BackupDir string
+
+	//record the timings of each phase; can be nil
+	Trace *MoveTrace
+
+	//record events on the original and new pods; can be nil
+	Recorder record.EventRecorder
+
+	//how the fields of the original pod are copied; the default policy if nil
+	Policy *SanitizePolicy
+
+	//changes made to the copy before it is created; can be nil
+	Mutation *PodMutation
+
+	//the grace period to delete the original pod with; the pod's own if nil
+	Grace *GracePolicy
+
+	//how long to wait for the original pod to be gone, before its copy is created; the grace period plus a margin if 0
+	TerminationTimeout time.Duration
+
+	//create the copy with a generated name if the original pod is still terminating after TerminationTimeout,
+	//unless the pod depends on its name
+	NameFallback bool
+
+	//the move is aborted if this is closed before the original pod is deleted; can be nil
+	Cancel <-chan struct{}
+}
+
+func (o *MoveOptions) IsCancelled() bool {
+	select {
+	case <-o.Cancel:
+		return true
+	default:
+		return false
 	}
-	return grace
 }
 
 // move pod nameSpace/podName to node nodeName
-func MovePod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum int) error {
+func MovePod(client *kclient.Clientset, pod *api.Pod, nodeName string, opts *MoveOptions) error {
 	podClient := client.CoreV1().Pods(pod.Namespace)
 	if podClient == nil {
 		err := fmt.Errorf("cannot get Pod client for nameSpace:%v", pod.Namespace)
@@ -48,33 +77,87 @@ func MovePod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum
 	glog.V(2).Infof("move-pod: begin to move %v from %v to %v",
 		id, pod.Spec.NodeName, nodeName)
 
-	npod := &api.Pod{}
-	CopyPodInfo(pod, npod)
-	npod.Spec.NodeName = nodeName
+	npod, err := ClonePodForMove(pod, nodeName, opts.Policy)
+	if err != nil {
+		merr := NewMoveError(ReasonInvalidInput, "move-aborted: failed to copy pod-%v: %v", id, err)
+		glog.Error(merr)
+		return merr
+	}
+	if err := opts.Mutation.Apply(npod); err != nil {
+		merr := NewMoveError(ReasonInvalidInput, "move-aborted: failed to mutate the copy of pod-%v: %v", id, err)
+		glog.Error(merr)
+		return merr
+	}
+
+	//1.1 backup the original pod, so that it can be restored if anything goes wrong
+	if opts.BackupDir != "" {
+		if _, err := BackupPod(opts.BackupDir, pod, npod); err != nil {
+			merr := NewMoveError(ReasonBackupFailed, "move-aborted: failed to backup pod-%v: %v", id, err)
+			glog.Error(merr)
+			return merr
+		}
+	}
 
 	//2. kill original pod
-	grace := calcGracePeriod(pod)
-	delOption := &metav1.DeleteOptions{GracePeriodSeconds: &grace}
-	err := podClient.Delete(pod.Name, delOption)
-	if err != nil {
-		err = fmt.Errorf("move-failed: failed to delete original pod-%v: %v",
-			id, err)
-		glog.Error(err)
+	if opts.IsCancelled() {
+		merr := NewMoveError(ReasonCancelled, "move-aborted: move of pod-%v is cancelled", id)
+		glog.Warning(merr)
+		return merr
+	}
+
+	grace := CalcGracePeriod(pod, opts.Grace)
+	t0 := time.Now()
+	if err := DeleteOriginalPod(client, pod, nodeName, opts); err != nil {
+		opts.Trace.AddPhase(PhaseDelete, t0, err)
 		return err
 	}
+	//wait for the previous pod to be cleaned up, so that the copy can take its name.
+	timeout := opts.TerminationTimeout
+	if timeout <= 0 {
+		timeout = grace.TerminationTimeout()
+	}
+	if lingering, err := WaitPodTerminated(client, pod, timeout); err != nil {
+		if ReasonForError(err) == ReasonPodChanged {
+			//another pod has taken the name; never create a copy next to a pod we did not copy
+			opts.Trace.AddPhase(PhaseDelete, t0, err)
+			merr := NewMoveError(ReasonPodChanged, "move-aborted: the copy of pod-%v is not created: %v", id, err)
+			glog.Error(merr)
+			return merr
+		}
+
+		RecordEvent(opts.Recorder, pod, api.EventTypeWarning, EventPodTerminationBlocked,
+			"Pod is still terminating after %v: %v", timeout, DescribeTermination(lingering))
+
+		if !opts.NameFallback || dependsOnPodName(pod, npod) {
+			opts.Trace.AddPhase(PhaseDelete, t0, err)
+			merr := NewMoveError(ReasonTerminationTimeout, "move-failed: the copy of pod-%v is not created: %v", id, err)
+			glog.Error(merr)
+			return merr
+		}
+
+		glog.Warningf("%v; create the copy of pod-%v with a generated name", err, id)
+		useGeneratedName(pod, npod)
+	}
+	opts.Trace.AddPhase(PhaseDelete, t0, nil)
 
 	//3. create (and bind) the new Pod
-	time.Sleep(time.Duration(grace+1) * time.Second) //wait for the previous pod to be cleaned up.
-	du := time.Duration(grace+3) * time.Second
-	err = RetryDuring(retryNum, du*time.Duration(retryNum), defaultSleep, func() error {
-		_, inerr := podClient.Create(npod)
+	t0 = time.Now()
+	du := defaultTimeOut
+	err = RetryDuring(opts.RetryNum, du*time.Duration(opts.RetryNum), defaultSleep, func() error {
+		created, inerr := CreatePodCopy(client, npod, pod.Spec.NodeName, opts)
+		if inerr == nil && created.Name != pod.Name {
+			opts.Trace.SetNewPod(created.Name)
+		}
 		return inerr
 	})
+	opts.Trace.AddPhase(PhaseCreate, t0, err)
 	if err != nil {
-		err = fmt.Errorf("move-failed: failed to create new pod-%v: %v",
+		RecordEvent(opts.Recorder, pod, api.EventTypeWarning, EventPodCreateFailed,
+			"Failed to create the new pod on node %v: %v", nodeName, err)
+		merr := NewMoveError(ReasonCreateFailed, "move-failed: failed to create new pod-%v: %v",
 			id, err)
-		glog.Error(err)
-		return err
+		glog.Error(merr)
+		return merr
 	}
 
 	glog.V(2).Infof("move-finished: %v from %v to %v",
@@ -83,6 +166,92 @@ func MovePod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum
 	return nil
 }
 
+// whether the copy should keep the name of the pod: the pods of a StatefulSet, and the pods whose hostname is kept
+func dependsOnPodName(pod, npod *api.Pod) bool {
+	if kind, _, err := ParseParentInfo(pod); err != nil || kind == kindStatefulSet {
+		return true
+	}
+	if npod.Spec.Hostname != "" || npod.Spec.Subdomain != "" {
+		return true
+	}
+	_, hostname := npod.Annotations[hostnameAnnotationKey]
+	_, subdomain := npod.Annotations[subdomainAnnotationKey]
+	return hostname || subdomain
+}
+
+// let the apiserver generate the name of the copy, as the parent does for its pods
+func useGeneratedName(pod, npod *api.Pod) {
+	npod.GenerateName = pod.GenerateName
+	if npod.GenerateName == "" {
+		npod.GenerateName = pod.Name + "-"
+	}
+	npod.Name = ""
+}
+
+// make a copy of the pod by the policy, which will be bound to nodeName on creation;
+// the default policy of a standalone pod is used if policy is nil.
+func ClonePodForMove(pod *api.Pod, nodeName string, policy *SanitizePolicy) (*api.Pod, error) {
+	if policy == nil {
+		policy = DefaultSanitizePolicy(true)
+	}
+
+	npod, err := policy.Apply(pod)
+	if err != nil {
+		return nil, err
+	}
+	npod.Spec.NodeName = nodeName
+	return npod, nil
+}
+
+// delete the original pod, with the grace period calculated by CalcGracePeriod
+func DeleteOriginalPod(client *kclient.Clientset, pod *api.Pod, nodeName string, opts *MoveOptions) error {
+	id := fmt.Sprintf("%v/%v", pod.Namespace, pod.Name)
+	grace := CalcGracePeriod(pod, opts.Grace)
+	delOption := PodDeleteOptions(pod, grace.Seconds)
+
+	opts.Trace.SetGracePeriod(grace)
+	if grace.Capped {
+		glog.Warningf("grace period of pod-%v is capped: %v", id, grace)
+	}
+	if grace.Force {
+		glog.Warningf("pod-%v is force deleted: its containers may still be running on node %v when the copy starts",
+			id, pod.Spec.NodeName)
+	}
+
+	RecordEvent(opts.Recorder, pod, api.EventTypeNormal, EventPodDeleting,
+		"Deleting pod with grace period %v to move it from node %v to node %v", grace, pod.Spec.NodeName, nodeName)
+	err := client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, delOption)
+	if IsPodChangedError(err) {
+		//the pod was deleted or replaced since we got it; never delete a pod we did not copy
+		merr := NewMoveError(ReasonPodChanged, "move-aborted: pod-%v (uid %v) is gone or replaced by another pod: %v",
+			id, pod.UID, err)
+		glog.Error(merr)
+		return merr
+	}
+	if err != nil {
+		RecordEvent(opts.Recorder, pod, api.EventTypeWarning, EventPodDeleteFailed,
+			"Failed to delete pod for moving: %v", err)
+		merr := NewMoveError(ReasonDeleteFailed, "move-failed: failed to delete original pod-%v: %v",
+			id, err)
+		glog.Error(merr)
+		return merr
+	}
+
+	return nil
+}
+
+// create the copy of the original pod, and record an event on it
+func CreatePodCopy(client *kclient.Clientset, npod *api.Pod, sourceNode string, opts *MoveOptions) (*api.Pod, error) {
+	created, err := client.CoreV1().Pods(npod.Namespace).Create(npod)
+	if err != nil {
+		return nil, err
+	}
+
+	RecordEvent(opts.Recorder, created, api.EventTypeNormal, EventPodCreated,
+		"Created by moving pod from node %v to node %v", sourceNode, npod.Spec.NodeName)
+	return created, nil
+}
+
 //---------------Move Helper---------------
 
 type getSchedulerNameFunc func(client *kclient.Clientset, nameSpace, name string) (string, error)
@@ -141,7 +310,7 @@ func NewMoveHelper(client *kclient.Clientset, nameSpace, name, kind, parentName,
 			p.updateSchedulerName = UpdateRSscheduler15
 		}
 	default:
-		return nil, fmt.Errorf("unsupported kind: %s", kind)
+		return nil, NewMoveError(ReasonUnsupportedParent, "unsupported kind: %s", kind)
 	}
 
 	return p, nil
@@ -192,14 +361,31 @@ func (h *moveHelper) SetScheduler(schedulerName string) {
 }
 
 // CleanUp: (1) restore scheduler Name, (2) Release lock
-func (h *moveHelper) CleanUp() {
+// return true if the scheduler is restored.
+func (h *moveHelper) CleanUp() (bool, error) {
 	if !(h.flag) {
-		return
+		return false, nil
 	}
 
 	if flag, _ := h.CheckScheduler(h.schedulerNone, defaultRetryLess); !flag {
-		return
+		return false, nil
+	}
+
+	if _, err := h.UpdateScheduler(h.scheduler, defaultRetryMore); err != nil {
+		merr := NewMoveError(ReasonSchedulerRestoreFailed, "failed to restore scheduler of %v-%v/%v to [%v]: %v",
+			h.kind, h.nameSpace, h.controllerName, h.scheduler, err)
+		glog.Error(merr)
+		return false, merr
 	}
 
-	h.UpdateScheduler(h.scheduler, defaultRetryMore)
+	return true, nil
+}
+
+func (h *moveHelper) GetScheduler() string {
+	return h.scheduler
+}
+
+// get the current scheduler of the parent controller
+func (h *moveHelper) GetCurrentScheduler() (string, error) {
+	return h.getSchedulerName(h.client, h.nameSpace, h.controllerName)
 }
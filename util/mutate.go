@@ -0,0 +1,199 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+// PodMutation changes the copy of the pod before it is created.
+type PodMutation struct {
+	AddLabels         map[string]string
+	RemoveLabels      []string
+	AddAnnotations    map[string]string
+	RemoveAnnotations []string
+
+	//appended to the tolerations of the pod, replacing the ones with the same key and effect
+	Tolerations []api.Toleration
+
+	//requests and limits to be set, merged into the current ones of the containers
+	Requests api.ResourceList
+	Limits   api.ResourceList
+	//name of the container whose resources are changed; all the containers if empty
+	Container string
+}
+
+// whether the mutation changes nothing
+func (m *PodMutation) IsEmpty() bool {
+	return len(m.AddLabels) == 0 && len(m.RemoveLabels) == 0 &&
+		len(m.AddAnnotations) == 0 && len(m.RemoveAnnotations) == 0 &&
+		len(m.Tolerations) == 0 && len(m.Requests) == 0 && len(m.Limits) == 0
+}
+
+// apply the mutation to the pod; the mutation can be nil.
+func (m *PodMutation) Apply(pod *api.Pod) error {
+	if m == nil {
+		return nil
+	}
+
+	pod.Labels = mutateMap(pod.Labels, m.AddLabels, m.RemoveLabels)
+	pod.Annotations = mutateMap(pod.Annotations, m.AddAnnotations, m.RemoveAnnotations)
+
+	for _, t := range m.Tolerations {
+		pod.Spec.Tolerations = addToleration(pod.Spec.Tolerations, t)
+	}
+
+	if len(m.Requests) == 0 && len(m.Limits) == 0 {
+		return nil
+	}
+
+	found := false
+	for i := range pod.Spec.Containers {
+		c := &(pod.Spec.Containers[i])
+		if m.Container != "" && c.Name != m.Container {
+			continue
+		}
+		found = true
+
+		c.Resources.Requests = mergeResources(c.Resources.Requests, m.Requests)
+		c.Resources.Limits = mergeResources(c.Resources.Limits, m.Limits)
+		if err := checkResources(c); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("container %v is not found in pod %v/%v", m.Container, pod.Namespace, pod.Name)
+	}
+	return nil
+}
+
+func mutateMap(current, add map[string]string, remove []string) map[string]string {
+	if len(add) == 0 && len(remove) == 0 {
+		return current
+	}
+
+	result := make(map[string]string)
+	for k, v := range current {
+		result[k] = v
+	}
+	for _, k := range remove {
+		delete(result, k)
+	}
+	for k, v := range add {
+		result[k] = v
+	}
+	return result
+}
+
+func addToleration(tolerations []api.Toleration, t api.Toleration) []api.Toleration {
+	result := []api.Toleration{}
+	for _, old := range tolerations {
+		if old.Key == t.Key && old.Effect == t.Effect {
+			glog.V(3).Infof("toleration %v:%v is replaced", t.Key, t.Effect)
+			continue
+		}
+		result = append(result, old)
+	}
+	return append(result, t)
+}
+
+func mergeResources(current, changes api.ResourceList) api.ResourceList {
+	if len(changes) == 0 {
+		return current
+	}
+
+	result := api.ResourceList{}
+	for name, q := range current {
+		result[name] = q
+	}
+	for name, q := range changes {
+		result[name] = q
+	}
+	return result
+}
+
+// the requests should not exceed the limits
+func checkResources(c *api.Container) error {
+	for name, request := range c.Resources.Requests {
+		limit, ok := c.Resources.Limits[name]
+		if ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("request of %v (%v) exceeds its limit (%v) in container %v",
+				name, request.String(), limit.String(), c.Name)
+		}
+	}
+	return nil
+}
+
+//---------- parse the mutations from flags ----------
+
+// parse "k1=v1,k2=v2"
+func ParseKeyValues(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	if s == "" {
+		return result, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid key=value: %v", item)
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+// parse "key=value:Effect,key:Effect", in the syntax of kubectl taint;
+// the Equal operator is used if value is given, Exists otherwise.
+func ParseTolerations(s string) ([]api.Toleration, error) {
+	result := []api.Toleration{}
+	if s == "" {
+		return result, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid toleration, should be key[=value]:Effect: %v", item)
+		}
+
+		effect := api.TaintEffect(parts[1])
+		switch effect {
+		case api.TaintEffectNoSchedule, api.TaintEffectPreferNoSchedule, api.TaintEffectNoExecute:
+		default:
+			return nil, fmt.Errorf("invalid effect of toleration %v: %v", item, effect)
+		}
+
+		t := api.Toleration{Key: parts[0], Operator: api.TolerationOpExists, Effect: effect}
+		if kv := strings.SplitN(parts[0], "=", 2); len(kv) == 2 {
+			t.Key = kv[0]
+			t.Value = kv[1]
+			t.Operator = api.TolerationOpEqual
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// parse "cpu=100m,memory=128Mi"
+func ParseResourceList(s string) (api.ResourceList, error) {
+	kvs, err := ParseKeyValues(s)
+	if err != nil {
+		return nil, err
+	}
+
+	result := api.ResourceList{}
+	for name, value := range kvs {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity of %v: %v", name, err)
+		}
+		result[api.ResourceName(name)] = q
+	}
+	return result, nil
+}
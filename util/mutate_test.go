@@ -0,0 +1,84 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+func TestParseTolerations(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []api.Toleration
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  []api.Toleration{},
+		},
+		{
+			name:  "key and value",
+			input: "dedicated=batch:NoSchedule",
+			want: []api.Toleration{
+				{Key: "dedicated", Value: "batch", Operator: api.TolerationOpEqual, Effect: api.TaintEffectNoSchedule},
+			},
+		},
+		{
+			name:  "key only",
+			input: "gpu:NoExecute",
+			want: []api.Toleration{
+				{Key: "gpu", Operator: api.TolerationOpExists, Effect: api.TaintEffectNoExecute},
+			},
+		},
+		{
+			name:  "several",
+			input: "dedicated=batch:NoSchedule,gpu:PreferNoSchedule",
+			want: []api.Toleration{
+				{Key: "dedicated", Value: "batch", Operator: api.TolerationOpEqual, Effect: api.TaintEffectNoSchedule},
+				{Key: "gpu", Operator: api.TolerationOpExists, Effect: api.TaintEffectPreferNoSchedule},
+			},
+		},
+		{
+			name:  "empty value",
+			input: "dedicated=:NoSchedule",
+			want: []api.Toleration{
+				{Key: "dedicated", Value: "", Operator: api.TolerationOpEqual, Effect: api.TaintEffectNoSchedule},
+			},
+		},
+		{
+			name:    "missing effect",
+			input:   "dedicated=batch",
+			wantErr: true,
+		},
+		{
+			name:    "unknown effect",
+			input:   "dedicated=batch:NoRun",
+			wantErr: true,
+		},
+		{
+			name:    "one bad item",
+			input:   "gpu:NoExecute,dedicated",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTolerations(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected an error for %q, got %v", tt.name, tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error for %q: %v", tt.name, tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: ParseTolerations(%q) = %+v, want %+v", tt.name, tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kclient "k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// how long to wait for the parent to create the replacement pod
+	orphanReplacementTimeout = time.Second * 30
+	// how long to wait for the replacement to be running, before the orphan is deleted
+	orphanReadyTimeout = time.Minute
+	orphanPollInterval = time.Second
+)
+
+// get the label selector of the parent, and its matchLabels
+func getParentSelector(client *kclient.Clientset, nameSpace, kind, name string) (labels.Selector, map[string]string, error) {
+	option := metav1.GetOptions{}
+	var matchLabels map[string]string
+	var selector labels.Selector
+
+	switch kind {
+	case kindReplicationController:
+		rc, err := client.CoreV1().ReplicationControllers(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, nil, err
+		}
+		matchLabels = rc.Spec.Selector
+		selector = labels.SelectorFromSet(rc.Spec.Selector)
+	case kindReplicaSet:
+		rs, err := client.ExtensionsV1beta1().ReplicaSets(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rs.Spec.Selector == nil {
+			return nil, nil, fmt.Errorf("ReplicaSet %v/%v has no selector", nameSpace, name)
+		}
+		matchLabels = rs.Spec.Selector.MatchLabels
+		if selector, err = metav1.LabelSelectorAsSelector(rs.Spec.Selector); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, NewMoveError(ReasonUnsupportedParent, "unsupported kind: %s", kind)
+	}
+
+	return selector, matchLabels, nil
+}
+
+// the label (from the matchLabels of the parent) to take the pod out of the parent's selector
+func getOrphanLabel(matchLabels map[string]string) (string, string, error) {
+	if len(matchLabels) == 0 {
+		return "", "", fmt.Errorf("no matchLabels to orphan the pod by")
+	}
+
+	keys := make([]string, 0, len(matchLabels))
+	for k := range matchLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys[0], matchLabels[keys[0]], nil
+}
+
+// set the label of the pod; remove it if value is nil
+func patchPodLabel(client *kclient.Clientset, pod *api.Pod, key string, value *string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]*string{key: value},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.CoreV1().Pods(pod.Namespace).Patch(pod.Name, types.StrategicMergePatchType, data)
+	return err
+}
+
+// names of the pods matching the selector
+func listSelectedPods(client *kclient.Clientset, nameSpace string, selector labels.Selector) (map[string]bool, error) {
+	pods, err := client.CoreV1().Pods(nameSpace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool)
+	for i := range pods.Items {
+		result[pods.Items[i].Name] = true
+	}
+	return result, nil
+}
+
+// wait for a pod matching the selector, which is not known yet
+func waitReplacement(client *kclient.Clientset, nameSpace string, selector labels.Selector, known map[string]bool) (*api.Pod, error) {
+	var result *api.Pod
+	err := wait.Poll(orphanPollInterval, orphanReplacementTimeout, func() (bool, error) {
+		pods, err := client.CoreV1().Pods(nameSpace).List(metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			glog.Warningf("failed to list pods of %v: %v", selector, err)
+			return false, nil
+		}
+
+		for i := range pods.Items {
+			pod := &(pods.Items[i])
+			if known[pod.Name] || pod.DeletionTimestamp != nil {
+				continue
+			}
+			result = pod
+			return true, nil
+		}
+		return false, nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("no replacement pod is created in %v", orphanReplacementTimeout)
+	}
+	return result, nil
+}
+
+// bind the replacement to nodeName; it is not scheduled by others, as the scheduler of the parent is swapped meanwhile.
+// If it is bound to another node anyway, delete it, so that the parent creates another one.
+func steerReplacement(client *kclient.Clientset, nameSpace string, selector labels.Selector, known map[string]bool,
+	nodeName string, retry int) (*api.Pod, error) {
+	podClient := client.CoreV1().Pods(nameSpace)
+
+	for i := 0; i <= retry; i++ {
+		npod, err := waitReplacement(client, nameSpace, selector, known)
+		if err != nil {
+			return nil, err
+		}
+		known[npod.Name] = true
+
+		if npod.Spec.NodeName == "" {
+			binding := &api.Binding{
+				ObjectMeta: metav1.ObjectMeta{Namespace: nameSpace, Name: npod.Name},
+				Target:     api.ObjectReference{Kind: "Node", Name: nodeName},
+			}
+			err = podClient.Bind(binding)
+			if err == nil {
+				glog.V(2).Infof("replacement pod %v/%v is bound to node %v", nameSpace, npod.Name, nodeName)
+				return npod, nil
+			}
+			glog.V(3).Infof("failed to bind replacement pod %v/%v: %v", nameSpace, npod.Name, err)
+
+			if npod, err = podClient.Get(npod.Name, metav1.GetOptions{}); err != nil {
+				return nil, err
+			}
+		}
+
+		if npod.Spec.NodeName == nodeName {
+			return npod, nil
+		}
+
+		glog.Warningf("replacement pod %v/%v is scheduled to node %v, instead of %v; delete it and try again",
+			nameSpace, npod.Name, npod.Spec.NodeName, nodeName)
+		if err := podClient.Delete(npod.Name, PodDeleteOptions(npod, 0)); err != nil && !IsPodChangedError(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("failed to steer the replacement pod to node %v in %d attempts", nodeName, retry+1)
+}
+
+// let the parent adopt the orphan again; it will delete the surplus pod by itself, preferring the one not ready.
+func restoreOrphanLabel(client *kclient.Clientset, pod *api.Pod, key, value string, opts *MoveOptions) {
+	id := fmt.Sprintf("%v/%v", pod.Namespace, pod.Name)
+	if err := patchPodLabel(client, pod, key, &value); err != nil {
+		glog.Errorf("failed to restore label %v=%v of pod-%v: %v", key, value, id, err)
+		return
+	}
+	opts.Trace.AddCleanup(fmt.Sprintf("restored label %v=%v of pod %v", key, value, id))
+}
+
+// move the pod without changing the template or replicas of its parent; the scheduler of the parent should be swapped by the caller:
+// take the pod out of the parent's selector, so that the parent creates a replacement;
+// bind the replacement to nodeName, and delete the orphan when the replacement is running.
+// If the replacement is not placed or not running, the orphan is returned to the parent. Return the replacement pod.
+func OrphanMovePod(client *kclient.Clientset, pod *api.Pod, parentKind, parentName, nodeName string, opts *MoveOptions) (*api.Pod, error) {
+	id := fmt.Sprintf("%v/%v", pod.Namespace, pod.Name)
+
+	selector, matchLabels, err := getParentSelector(client, pod.Namespace, parentKind, parentName)
+	if err != nil {
+		if ReasonForError(err) != ReasonUnknown {
+			return nil, err
+		}
+		return nil, NewMoveError(ReasonInvalidParent, "move-aborted: cannot get selector of %v %v: %v", parentKind, parentName, err)
+	}
+	key, value, err := getOrphanLabel(matchLabels)
+	if err != nil {
+		return nil, NewMoveError(ReasonInvalidParent, "move-aborted: %v %v: %v", parentKind, parentName, err)
+	}
+
+	known, err := listSelectedPods(client, pod.Namespace, selector)
+	if err != nil {
+		return nil, NewMoveError(ReasonGetPodFailed, "move-aborted: failed to list pods of %v %v: %v", parentKind, parentName, err)
+	}
+
+	if opts.IsCancelled() {
+		return nil, NewMoveError(ReasonCancelled, "move-aborted: move of pod-%v is cancelled", id)
+	}
+
+	//1. orphan the pod
+	t0 := time.Now()
+	err = patchPodLabel(client, pod, key, nil)
+	opts.Trace.AddPhase(PhaseOrphan, t0, err)
+	if err != nil {
+		merr := NewMoveError(ReasonOrphanFailed, "move-aborted: failed to remove label %v from pod-%v: %v", key, id, err)
+		glog.Error(merr)
+		return nil, merr
+	}
+	RecordEvent(opts.Recorder, pod, api.EventTypeNormal, EventPodOrphaned,
+		"Removed label %v=%v to release the pod from %v %v, for moving it to node %v", key, value, parentKind, parentName, nodeName)
+
+	//2. steer the replacement to the node
+	t0 = time.Now()
+	npod, err := steerReplacement(client, pod.Namespace, selector, known, nodeName, opts.RetryNum)
+	opts.Trace.AddPhase(PhaseCreate, t0, err)
+	if err != nil {
+		restoreOrphanLabel(client, pod, key, value, opts)
+		merr := NewMoveError(ReasonCreateFailed, "move-failed: no replacement of pod-%v on node %v: %v", id, nodeName, err)
+		glog.Error(merr)
+		return nil, merr
+	}
+	RecordEvent(opts.Recorder, npod, api.EventTypeNormal, EventPodCreated,
+		"Created by %v %v, and bound to node %v for replacing pod %v on node %v", parentKind, parentName, nodeName, pod.Name, pod.Spec.NodeName)
+
+	//3. delete the orphan, after the replacement is running
+	t0 = time.Now()
+	_, err = WaitPodMoveHealth(client, pod.Namespace, npod.Name, nodeName, orphanReadyTimeout)
+	opts.Trace.AddPhase(PhaseReady, t0, err)
+	if err != nil {
+		restoreOrphanLabel(client, pod, key, value, opts)
+		merr := NewMoveError(ReasonHealthCheckFailed, "move-failed: replacement pod %v/%v is not running, orphan pod-%v is returned to %v %v: %v",
+			pod.Namespace, npod.Name, id, parentKind, parentName, err)
+		glog.Error(merr)
+		return npod, merr
+	}
+
+	t0 = time.Now()
+	err = DeleteOriginalPod(client, pod, nodeName, opts)
+	opts.Trace.AddPhase(PhaseDelete, t0, err)
+	if err != nil {
+		return npod, err
+	}
+
+	glog.V(2).Infof("move-finished: %v from %v to %v, replaced by %v", id, pod.Spec.NodeName, nodeName, npod.Name)
+	return npod, nil
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kclient "k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	kindDaemonSet = "DaemonSet"
+	kindJob       = "Job"
+
+	// the legacy annotation telling the controller which created the pod (k8s < 1.6)
+	createdByAnnotationKey = "kubernetes.io/created-by"
+
+	// how the owner is found
+	OwnerSourceReference  = "ownerReference"
+	OwnerSourceAnnotation = "annotation"
+
+	// to stop walking a broken chain
+	maxOwnerChainDepth = 8
+)
+
+// OwnerInfo is one level of the owner chain of a pod.
+type OwnerInfo struct {
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+	APIVersion string    `json:"apiVersion"`
+	Source     string    `json:"source"`
+}
+
+// the controller in the ownerReferences; nil if there is none.
+func controllerOf(refs []metav1.OwnerReference) *OwnerInfo {
+	for _, ref := range refs {
+		if ref.Controller != nil && *ref.Controller {
+			return &OwnerInfo{
+				Kind:       ref.Kind,
+				Name:       ref.Name,
+				UID:        ref.UID,
+				APIVersion: ref.APIVersion,
+				Source:     OwnerSourceReference,
+			}
+		}
+	}
+	return nil
+}
+
+// get the ObjectMeta of an owner, and the apiVersion it is read by; return nil if its kind is not known,
+// so that the chain ends there.
+func getOwnerMeta(client *kclient.Clientset, nameSpace, kind, name string) (*metav1.ObjectMeta, string, error) {
+	option := metav1.GetOptions{}
+
+	switch kind {
+	case kindReplicationController:
+		obj, err := client.CoreV1().ReplicationControllers(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, "", err
+		}
+		return &obj.ObjectMeta, "v1", nil
+	case kindReplicaSet:
+		obj, err := client.ExtensionsV1beta1().ReplicaSets(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, "", err
+		}
+		return &obj.ObjectMeta, "extensions/v1beta1", nil
+	case kindDeployment:
+		obj, err := client.ExtensionsV1beta1().Deployments(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, "", err
+		}
+		return &obj.ObjectMeta, "extensions/v1beta1", nil
+	case kindDaemonSet:
+		obj, err := client.ExtensionsV1beta1().DaemonSets(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, "", err
+		}
+		return &obj.ObjectMeta, "extensions/v1beta1", nil
+	case kindStatefulSet:
+		obj, err := client.AppsV1beta1().StatefulSets(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, "", err
+		}
+		return &obj.ObjectMeta, "apps/v1beta1", nil
+	case kindJob:
+		obj, err := client.BatchV1().Jobs(nameSpace).Get(name, option)
+		if err != nil {
+			return nil, "", err
+		}
+		return &obj.ObjectMeta, "batch/v1", nil
+	}
+
+	return nil, "", nil
+}
+
+// walk the owners of the pod, from its direct controller to the top, e.g. ReplicaSet -> Deployment.
+// The UID and apiVersion of an owner found by the legacy annotation are filled from the object if it can be got.
+func GetOwnerChain(client *kclient.Clientset, pod *api.Pod) ([]OwnerInfo, error) {
+	chain := []OwnerInfo{}
+
+	owner, err := ParsePodOwner(pod)
+	if err != nil {
+		return chain, err
+	}
+
+	for owner != nil && len(chain) < maxOwnerChainDepth {
+		meta, apiVersion, err := getOwnerMeta(client, pod.Namespace, owner.Kind, owner.Name)
+		if err != nil {
+			chain = append(chain, *owner)
+			return chain, fmt.Errorf("failed to get %v %v/%v: %v", owner.Kind, pod.Namespace, owner.Name, err)
+		}
+
+		if meta != nil && owner.UID == "" {
+			owner.UID = meta.UID
+		}
+		if meta != nil && owner.APIVersion == "" {
+			owner.APIVersion = apiVersion
+		}
+		chain = append(chain, *owner)
+
+		if meta == nil {
+			break
+		}
+		owner = controllerOf(meta.OwnerReferences)
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func newOwnerReference(kind, name string, controller *bool) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "extensions/v1beta1",
+		Kind:       kind,
+		Name:       name,
+		UID:        "uid-" + name,
+		Controller: controller,
+	}
+}
+
+func TestParsePodOwner(t *testing.T) {
+	rs := &OwnerInfo{Kind: kindReplicaSet, Name: "web", UID: "uid-web", APIVersion: "extensions/v1beta1", Source: OwnerSourceReference}
+	createdBy := `{"kind":"SerializedReference","apiVersion":"v1","reference":{"kind":"ReplicationController","namespace":"default","name":"old","uid":"uid-old","apiVersion":"v1"}}`
+
+	tests := []struct {
+		name        string
+		refs        []metav1.OwnerReference
+		annotations map[string]string
+		want        *OwnerInfo
+	}{
+		{
+			name: "no owner",
+		},
+		{
+			name: "controller",
+			refs: []metav1.OwnerReference{newOwnerReference(kindReplicaSet, "web", boolPtr(true))},
+			want: rs,
+		},
+		{
+			name: "nil controller flag",
+			refs: []metav1.OwnerReference{newOwnerReference(kindReplicaSet, "web", nil)},
+		},
+		{
+			name: "false controller flag",
+			refs: []metav1.OwnerReference{newOwnerReference(kindReplicaSet, "web", boolPtr(false))},
+		},
+		{
+			name: "controller after owners which are not",
+			refs: []metav1.OwnerReference{
+				newOwnerReference(kindDeployment, "other", nil),
+				newOwnerReference(kindDeployment, "another", boolPtr(false)),
+				newOwnerReference(kindReplicaSet, "web", boolPtr(true)),
+			},
+			want: rs,
+		},
+		{
+			name:        "annotation when no owner is the controller",
+			refs:        []metav1.OwnerReference{newOwnerReference(kindReplicaSet, "web", nil)},
+			annotations: map[string]string{createdByAnnotationKey: createdBy},
+			want: &OwnerInfo{Kind: kindReplicationController, Name: "old", UID: "uid-old", APIVersion: "v1",
+				Source: OwnerSourceAnnotation},
+		},
+	}
+
+	for _, tt := range tests {
+		pod := &api.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "web-1",
+			OwnerReferences: tt.refs,
+			Annotations:     tt.annotations,
+		}}
+		got, err := ParsePodOwner(pod)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: ParsePodOwner = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -4,40 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/golang/glog"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kclient "k8s.io/client-go/kubernetes"
 	api "k8s.io/client-go/pkg/api/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-//TODO: check which fields should be copied
-func CopyPodInfo(oldPod, newPod *api.Pod) {
-	//1. typeMeta
-	newPod.TypeMeta = oldPod.TypeMeta
-
-	//2. objectMeta
-	newPod.ObjectMeta = oldPod.ObjectMeta
-	newPod.SelfLink = ""
-	newPod.ResourceVersion = ""
-	newPod.Generation = 0
-	newPod.CreationTimestamp = metav1.Time{}
-	newPod.DeletionTimestamp = nil
-	newPod.DeletionGracePeriodSeconds = nil
-
-	//3. podSpec
-	spec := oldPod.Spec
-	spec.Hostname = ""
-	spec.Subdomain = ""
-	spec.NodeName = ""
-
-	newPod.Spec = spec
-	return
-}
-
-//--------------------------
-
 func printPods(pods *api.PodList) {
 	fmt.Printf("api version:%s, kind:%s, r.version:%s\n",
 		pods.APIVersion,
@@ -65,104 +43,138 @@ func ListPod(client *kclient.Clientset) {
 	glog.V(2).Info("test finish")
 }
 
-func copyPodInfoX(oldPod, newPod *api.Pod) {
-	//1. typeMeta -- full copy
-	newPod.Kind = oldPod.Kind
-	newPod.APIVersion = oldPod.APIVersion
-
-	//2. objectMeta -- partial copy
-	newPod.Name = oldPod.Name
-	newPod.GenerateName = oldPod.GenerateName
-	newPod.Namespace = oldPod.Namespace
-	//newPod.SelfLink = oldPod.SelfLink
-	newPod.UID = oldPod.UID
-	//newPod.ResourceVersion = oldPod.ResourceVersion
-	//newPod.Generation = oldPod.Generation
-	//newPod.CreationTimestamp = oldPod.CreationTimestamp
-
-	//NOTE: Deletion timestamp and gracePeriod will be set by system when to delete it.
-	//newPod.DeletionTimestamp = oldPod.DeletionTimestamp
-	//newPod.DeletionGracePeriodSeconds = oldPod.DeletionGracePeriodSeconds
-
-	newPod.Labels = oldPod.Labels
-	newPod.Annotations = oldPod.Annotations
-	newPod.OwnerReferences = oldPod.OwnerReferences
-	newPod.Initializers = oldPod.Initializers
-	newPod.Finalizers = oldPod.Finalizers
-	newPod.ClusterName = oldPod.ClusterName
-
-	//3. podSpec -- full copy with modifications
-	spec := oldPod.Spec
-	spec.Hostname = ""
-	spec.Subdomain = ""
-	spec.NodeName = ""
-
-	newPod.Spec = spec
-
-	//4. status: won't copy status
+func ParseParentInfo(pod *api.Pod) (string, string, error) {
+	owner, err := ParsePodOwner(pod)
+	if err != nil || owner == nil {
+		return "", "", err
+	}
+	return owner.Kind, owner.Name, nil
 }
 
-func ParseParentInfo(pod *api.Pod) (string, string, error) {
+// get the controller of the pod, by its ownerReferences, or by the legacy created-by annotation;
+// return nil if the pod has no controller.
+func ParsePodOwner(pod *api.Pod) (*OwnerInfo, error) {
 	//1. check ownerReferences:
-	if pod.OwnerReferences != nil && len(pod.OwnerReferences) > 0 {
-		for _, owner := range pod.OwnerReferences {
-			if *owner.Controller {
-				return owner.Kind, owner.Name, nil
-			}
-		}
+	if owner := controllerOf(pod.OwnerReferences); owner != nil {
+		return owner, nil
 	}
 
 	glog.V(3).Infof("cannot find pod-%v/%v parent by OwnerReferences.", pod.Namespace, pod.Name)
 
 	//2. check annotations:
 	if pod.Annotations != nil && len(pod.Annotations) > 0 {
-		key := "kubernetes.io/created-by"
-		if value, ok := pod.Annotations[key]; ok {
+		if value, ok := pod.Annotations[createdByAnnotationKey]; ok {
 			var ref api.SerializedReference
 
 			if err := json.Unmarshal([]byte(value), &ref); err != nil {
 				err = fmt.Errorf("failed to decode parent annoation:%v\n[%v]", err.Error(), value)
 				glog.Error(err.Error())
-				return "", "", err
+				return nil, err
 			}
 
-			return ref.Reference.Kind, ref.Reference.Name, nil
+			return &OwnerInfo{
+				Kind:       ref.Reference.Kind,
+				Name:       ref.Reference.Name,
+				UID:        ref.Reference.UID,
+				APIVersion: ref.Reference.APIVersion,
+				Source:     OwnerSourceAnnotation,
+			}, nil
 		}
 	}
 
 	glog.V(3).Infof("cannot find pod-%v/%v parent by Annotations.", pod.Namespace, pod.Name)
 
-	return "", "", nil
+	return nil, nil
 }
 
-func GetKubeClient(masterUrl, kubeConfig string) *kclient.Clientset {
-	if masterUrl == "" && kubeConfig == "" {
-		fmt.Println("must specify masterUrl or kubeConfig.")
-		return nil
-	}
+// ClientOptions tells how to connect to the cluster.
+type ClientOptions struct {
+	MasterUrl  string
+	KubeConfig string
+	// context in the kubeconfig; the current context if empty
+	Context string
 
-	var err error
+	// rate limit of the client; the client-go default is used if not positive
+	QPS   float32
+	Burst int
+}
+
+// build the client config: the in-cluster service-account config is used if no masterUrl, kubeConfig or context is given.
+func GetKubeConfig(opts *ClientOptions) (*restclient.Config, error) {
 	var config *restclient.Config
+	var err error
 
-	if kubeConfig != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeConfig)
+	if opts.MasterUrl == "" && opts.KubeConfig == "" && opts.Context == "" {
+		glog.V(3).Infof("no masterUrl or kubeConfig is given, use in-cluster config")
+		config, err = restclient.InClusterConfig()
 	} else {
-		config, err = clientcmd.BuildConfigFromFlags(masterUrl, "")
+		//only the given kubeconfig is loaded, so that the credentials of a local kubeconfig are not
+		//sent to the masterUrl; the default locations are searched only to find the given context.
+		rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: opts.KubeConfig}
+		if opts.KubeConfig == "" && opts.Context != "" {
+			rules = clientcmd.NewDefaultClientConfigLoadingRules()
+		}
+		overrides := &clientcmd.ConfigOverrides{
+			ClusterInfo:    clientcmdapi.Cluster{Server: opts.MasterUrl},
+			CurrentContext: opts.Context,
+		}
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build client config: %v", err)
+	}
+
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
+	return config, nil
+}
 
+func GetKubeClient(opts *ClientOptions) (*kclient.Clientset, error) {
+	config, err := GetKubeConfig(opts)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
+
 	// creates the clientset
 	clientset, err := kclient.NewForConfig(config)
 	if err != nil {
-		panic(err.Error())
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
 	}
 
-	return clientset
+	return clientset, nil
 }
 
-func CheckPodMoveHealth(client *kclient.Clientset, nameSpace, podName, nodeName string) error {
+// check whether the moved pod is running on the expected node; return the pod if it can be got.
+func CheckPodMoveHealth(client *kclient.Clientset, nameSpace, podName, nodeName string) (*api.Pod, error) {
+	pod, err := ProbePodMoveHealth(client, nameSpace, podName, nodeName)
+	if err != nil {
+		glog.Error(err.Error())
+	}
+	return pod, err
+}
+
+// wait until the moved pod is running on the expected node, or timeout.
+func WaitPodMoveHealth(client *kclient.Clientset, nameSpace, podName, nodeName string, timeout time.Duration) (*api.Pod, error) {
+	var pod *api.Pod
+	var err error
+
+	wait.Poll(time.Second, timeout, func() (bool, error) {
+		pod, err = ProbePodMoveHealth(client, nameSpace, podName, nodeName)
+		return err == nil, nil
+	})
+
+	if err != nil {
+		glog.Error(err.Error())
+	}
+	return pod, err
+}
+
+// same as CheckPodMoveHealth, without logging the error; for polling.
+func ProbePodMoveHealth(client *kclient.Clientset, nameSpace, podName, nodeName string) (*api.Pod, error) {
 	podClient := client.CoreV1().Pods(nameSpace)
 
 	id := fmt.Sprintf("%v/%v", nameSpace, podName)
@@ -170,30 +182,24 @@ func CheckPodMoveHealth(client *kclient.Clientset, nameSpace, podName, nodeName
 	getOption := metav1.GetOptions{}
 	pod, err := podClient.Get(podName, getOption)
 	if err != nil {
-		err = fmt.Errorf("failed ot get Pod-%v: %v", id, err.Error())
-		glog.Error(err.Error())
-		return err
+		return nil, NewMoveError(ReasonHealthCheckFailed, "failed ot get Pod-%v: %v", id, err.Error())
 	}
 
 	if pod.Status.Phase != api.PodRunning {
-		err = fmt.Errorf("pod-%v is not running: %v", id, pod.Status.Phase)
-		glog.Error(err.Error())
-		return err
+		return pod, NewMoveError(ReasonHealthCheckFailed, "pod-%v is not running: %v", id, pod.Status.Phase)
 	}
 
 	if pod.Spec.NodeName != nodeName {
-		err = fmt.Errorf("pod-%v is running on another Node (%v Vs. %v)",
+		return pod, NewMoveError(ReasonHealthCheckFailed, "pod-%v is running on another Node (%v Vs. %v)",
 			id, pod.Spec.NodeName, nodeName)
-		glog.Error(err.Error())
-		return err
 	}
 
-	return nil
+	return pod, nil
 }
 
-
-//clean the Pods created by Controller while controller's scheduler is invalid.
-func CleanPendingPod(client *kclient.Clientset, nameSpace, schedulerName, parentKind, parentName string, highver bool) error {
+// list the Pending Pods created by Controller while controller's scheduler is invalid;
+// these pods are to be deleted by CleanPendingPod.
+func ListPendingPod(client *kclient.Clientset, nameSpace, schedulerName, parentKind, parentName string, highver bool) ([]*api.Pod, error) {
 	podClient := client.CoreV1().Pods(nameSpace)
 
 	option := metav1.ListOptions{
@@ -202,12 +208,11 @@ func CleanPendingPod(client *kclient.Clientset, nameSpace, schedulerName, parent
 
 	pods, err := podClient.List(option)
 	if err != nil {
-		glog.Error("failed to cleanPendingPod: %v", err)
-		return err
+		glog.Errorf("failed to list pending pods: %v", err)
+		return nil, err
 	}
 
-	var grace int64 = 0
-	delOption := &metav1.DeleteOptions{GracePeriodSeconds: &grace}
+	result := []*api.Pod{}
 	for i := range pods.Items {
 		pod := &(pods.Items[i])
 
@@ -232,12 +237,52 @@ func CleanPendingPod(client *kclient.Clientset, nameSpace, schedulerName, parent
 			continue
 		}
 
+		result = append(result, pod)
+	}
+
+	return result, nil
+}
+
+// options to delete exactly this pod: a pod re-created with the same name has another UID, and is not deleted.
+func PodDeleteOptions(pod *api.Pod, grace int64) *metav1.DeleteOptions {
+	uid := pod.UID
+	return &metav1.DeleteOptions{
+		GracePeriodSeconds: &grace,
+		Preconditions:      &metav1.Preconditions{UID: &uid},
+	}
+}
+
+// whether the deletion by PodDeleteOptions failed because the pod is gone, or replaced by another one with the same name.
+func IsPodChangedError(err error) bool {
+	return err != nil && (errors.IsConflict(err) || errors.IsNotFound(err))
+}
+
+//clean the Pods created by Controller while controller's scheduler is invalid.
+// return the names of the deleted pods.
+func CleanPendingPod(client *kclient.Clientset, nameSpace, schedulerName, parentKind, parentName string, highver bool) ([]string, error) {
+	podClient := client.CoreV1().Pods(nameSpace)
+
+	pods, err := ListPendingPod(client, nameSpace, schedulerName, parentKind, parentName, highver)
+	if err != nil {
+		glog.Errorf("failed to cleanPendingPod: %v", err)
+		return nil, err
+	}
+
+	deleted := []string{}
+
+	for _, pod := range pods {
 		glog.V(3).Infof("Begin to delete Pending pod:%s/%s", nameSpace, pod.Name)
-		err2 := podClient.Delete(pod.Name, delOption)
+		err2 := podClient.Delete(pod.Name, PodDeleteOptions(pod, 0))
+		if IsPodChangedError(err2) {
+			glog.V(2).Infof("pending pod %s/%s is gone or replaced since listed; skip it", nameSpace, pod.Name)
+			continue
+		}
 		if err2 != nil {
 			glog.Warningf("failed ot delete pending pod:%s/%s: %v", nameSpace, pod.Name, err2)
+			continue
 		}
+		deleted = append(deleted, pod.Name)
 	}
 
-	return err
+	return deleted, err
 }
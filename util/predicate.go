@@ -0,0 +1,294 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	kclient "k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+// the predicates checked against the destination node.
+// The copy is bound by spec.nodeName, so the scheduler is bypassed; but the kubelet still rejects
+// a pod which does not fit, and evicts a pod not tolerating a NoExecute taint.
+const (
+	PredicateNodeReady         = "NodeReady"
+	PredicateNodeSchedulable   = "NodeSchedulable"
+	PredicateMatchNodeSelector = "MatchNodeSelector"
+	PredicateToleratesTaints   = "PodToleratesNodeTaints"
+	PredicateFitsResources     = "PodFitsResources"
+	PredicateFitsHostPorts     = "PodFitsHostPorts"
+)
+
+// PredicateResult is the verdict of a predicate.
+type PredicateResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+func newPredicateResult(name string, passed bool, format string, a ...interface{}) PredicateResult {
+	return PredicateResult{Name: name, Passed: passed, Message: fmt.Sprintf(format, a...)}
+}
+
+// check whether the pod can run on the node, in the order of the kubelet admission.
+func CheckNodePredicates(client *kclient.Clientset, pod *api.Pod, node *api.Node) []PredicateResult {
+	result := []PredicateResult{
+		checkNodeReady(node),
+		checkNodeSchedulable(node),
+		checkNodeSelector(pod, node),
+		checkTaints(pod, node),
+	}
+
+	//the pods already on the node, other than the pod itself
+	pods, err := listNodePods(client, node, pod.UID)
+	if err != nil {
+		msg := err.Error()
+		return append(result,
+			PredicateResult{Name: PredicateFitsResources, Message: msg},
+			PredicateResult{Name: PredicateFitsHostPorts, Message: msg})
+	}
+
+	return append(result, checkNodeResources(pod, node, pods), checkHostPorts(pod, pods))
+}
+
+// check whether the resource requests of npod fit the node, when it replaces the pod with the UID excluded;
+// so a pod can be checked against its node without the original pod it is re-created from.
+func CheckNodeResourcesFit(client *kclient.Clientset, npod *api.Pod, node *api.Node, excluded types.UID) PredicateResult {
+	pods, err := listNodePods(client, node, excluded)
+	if err != nil {
+		return PredicateResult{Name: PredicateFitsResources, Message: err.Error()}
+	}
+	return checkNodeResources(npod, node, pods)
+}
+
+// the running pods on the node, except the one with the UID excluded
+func listNodePods(client *kclient.Clientset, node *api.Node, excluded types.UID) ([]*api.Pod, error) {
+	selector := fields.OneTermEqualSelector("spec.nodeName", node.Name).String()
+	list, err := client.CoreV1().Pods("").List(metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods on node %v: %v", node.Name, err)
+	}
+
+	pods := make([]*api.Pod, 0, len(list.Items))
+	for i := range list.Items {
+		p := &(list.Items[i])
+		if p.UID == excluded || p.Status.Phase == api.PodSucceeded || p.Status.Phase == api.PodFailed {
+			continue
+		}
+		pods = append(pods, p)
+	}
+	return pods, nil
+}
+
+func checkNodeReady(node *api.Node) PredicateResult {
+	for _, c := range node.Status.Conditions {
+		if c.Type == api.NodeReady {
+			return newPredicateResult(PredicateNodeReady, c.Status == api.ConditionTrue, "Ready is %v: %v", c.Status, c.Message)
+		}
+	}
+	return newPredicateResult(PredicateNodeReady, false, "node has no Ready condition")
+}
+
+// a cordoned node still runs the pods bound to it, so it is reported but passed
+func checkNodeSchedulable(node *api.Node) PredicateResult {
+	if node.Spec.Unschedulable {
+		return newPredicateResult(PredicateNodeSchedulable, true, "node is cordoned, which is bypassed by binding the pod")
+	}
+	return newPredicateResult(PredicateNodeSchedulable, true, "node is schedulable")
+}
+
+func checkNodeSelector(pod *api.Pod, node *api.Node) PredicateResult {
+	nodeLabels := labels.Set(node.Labels)
+	if len(pod.Spec.NodeSelector) > 0 && !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(nodeLabels) {
+		return newPredicateResult(PredicateMatchNodeSelector, false, "node does not match nodeSelector %v", labels.Set(pod.Spec.NodeSelector))
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return newPredicateResult(PredicateMatchNodeSelector, true, "node matches the nodeSelector")
+	}
+
+	//the terms are ORed
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for _, term := range terms {
+		selector, err := nodeSelectorTermAsSelector(term)
+		if err != nil {
+			return newPredicateResult(PredicateMatchNodeSelector, false, "invalid node affinity: %v", err)
+		}
+		if selector.Matches(nodeLabels) {
+			return newPredicateResult(PredicateMatchNodeSelector, true, "node matches the nodeSelector and the required node affinity")
+		}
+	}
+	return newPredicateResult(PredicateMatchNodeSelector, false, "node matches none of the %d required node affinity terms", len(terms))
+}
+
+func nodeSelectorTermAsSelector(term api.NodeSelectorTerm) (labels.Selector, error) {
+	ops := map[api.NodeSelectorOperator]selection.Operator{
+		api.NodeSelectorOpIn:           selection.In,
+		api.NodeSelectorOpNotIn:        selection.NotIn,
+		api.NodeSelectorOpExists:       selection.Exists,
+		api.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+		api.NodeSelectorOpGt:           selection.GreaterThan,
+		api.NodeSelectorOpLt:           selection.LessThan,
+	}
+
+	selector := labels.NewSelector()
+	for _, expr := range term.MatchExpressions {
+		op, ok := ops[expr.Operator]
+		if !ok {
+			return nil, fmt.Errorf("unknown operator %v", expr.Operator)
+		}
+		req, err := labels.NewRequirement(expr.Key, op, expr.Values)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*req)
+	}
+	return selector, nil
+}
+
+func toleratesTaint(tolerations []api.Toleration, taint *api.Taint) bool {
+	for _, t := range tolerations {
+		if t.Effect != "" && t.Effect != taint.Effect {
+			continue
+		}
+		if t.Key == "" && t.Operator == api.TolerationOpExists {
+			return true
+		}
+		if t.Key != taint.Key {
+			continue
+		}
+		if t.Operator == api.TolerationOpExists || t.Value == taint.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func taintString(taint *api.Taint) string {
+	if taint.Value == "" {
+		return fmt.Sprintf("%v:%v", taint.Key, taint.Effect)
+	}
+	return fmt.Sprintf("%v=%v:%v", taint.Key, taint.Value, taint.Effect)
+}
+
+// a NoExecute taint evicts the pod; a NoSchedule taint is bypassed by the binding, so it is reported but passed
+func checkTaints(pod *api.Pod, node *api.Node) PredicateResult {
+	var blocking, bypassed []string
+	for i := range node.Spec.Taints {
+		taint := &(node.Spec.Taints[i])
+		if taint.Effect == api.TaintEffectPreferNoSchedule || toleratesTaint(pod.Spec.Tolerations, taint) {
+			continue
+		}
+		if taint.Effect == api.TaintEffectNoExecute {
+			blocking = append(blocking, taintString(taint))
+		} else {
+			bypassed = append(bypassed, taintString(taint))
+		}
+	}
+
+	if len(blocking) > 0 {
+		return newPredicateResult(PredicateToleratesTaints, false, "pod does not tolerate taints [%v]", strings.Join(blocking, ", "))
+	}
+	if len(bypassed) > 0 {
+		return newPredicateResult(PredicateToleratesTaints, true, "NoSchedule taints [%v] are bypassed by binding the pod", strings.Join(bypassed, ", "))
+	}
+	return newPredicateResult(PredicateToleratesTaints, true, "pod tolerates the taints of the node")
+}
+
+// the requests of a pod: the sum of its containers, or the largest init container if it is larger
+func podRequests(pod *api.Pod) api.ResourceList {
+	result := api.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, quantity := range c.Resources.Requests {
+			sum := result[name]
+			sum.Add(quantity)
+			result[name] = sum
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, quantity := range c.Resources.Requests {
+			if current, ok := result[name]; !ok || quantity.Cmp(current) > 0 {
+				result[name] = *(quantity.Copy())
+			}
+		}
+	}
+	return result
+}
+
+func checkNodeResources(pod *api.Pod, node *api.Node, pods []*api.Pod) PredicateResult {
+	allocatable := node.Status.Allocatable
+	if podCount, ok := allocatable[api.ResourcePods]; ok && int64(len(pods)+1) > podCount.Value() {
+		return newPredicateResult(PredicateFitsResources, false, "node runs %d of at most %d pods", len(pods), podCount.Value())
+	}
+
+	requested := api.ResourceList{}
+	for _, p := range pods {
+		for name, quantity := range podRequests(p) {
+			sum := requested[name]
+			sum.Add(quantity)
+			requested[name] = sum
+		}
+	}
+
+	var insufficient []string
+	for name, quantity := range podRequests(pod) {
+		capacity, ok := allocatable[name]
+		if !ok {
+			continue
+		}
+		free := *(capacity.Copy())
+		used := requested[name]
+		free.Sub(used)
+		if quantity.Cmp(free) > 0 {
+			insufficient = append(insufficient, fmt.Sprintf("%v: requests %v, free %v", name, quantity.String(), freeString(free)))
+		}
+	}
+
+	if len(insufficient) > 0 {
+		return newPredicateResult(PredicateFitsResources, false, "insufficient %v", strings.Join(insufficient, "; "))
+	}
+	return newPredicateResult(PredicateFitsResources, true, "node has enough allocatable resources")
+}
+
+func freeString(q resource.Quantity) string {
+	if q.Sign() < 0 {
+		return "0"
+	}
+	return q.String()
+}
+
+func checkHostPorts(pod *api.Pod, pods []*api.Pod) PredicateResult {
+	used := make(map[string]string)
+	for _, p := range pods {
+		for _, c := range p.Spec.Containers {
+			for _, port := range c.Ports {
+				if port.HostPort > 0 {
+					used[fmt.Sprintf("%v/%d", port.Protocol, port.HostPort)] = p.Namespace + "/" + p.Name
+				}
+			}
+		}
+	}
+
+	var conflicts []string
+	for _, c := range pod.Spec.Containers {
+		for _, port := range c.Ports {
+			key := fmt.Sprintf("%v/%d", port.Protocol, port.HostPort)
+			if owner, ok := used[key]; port.HostPort > 0 && ok {
+				conflicts = append(conflicts, fmt.Sprintf("%v is used by %v", key, owner))
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return newPredicateResult(PredicateFitsHostPorts, false, "host ports conflict: %v", strings.Join(conflicts, "; "))
+	}
+	return newPredicateResult(PredicateFitsHostPorts, true, "no host port conflicts")
+}
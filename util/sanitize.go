@@ -0,0 +1,328 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	kindStatefulSet = "StatefulSet"
+
+	// for Kubernetes version < 1.6, hostname and subdomain are set in Pod annotations
+	hostnameAnnotationKey  = "pod.beta.kubernetes.io/hostname"
+	subdomainAnnotationKey = "pod.beta.kubernetes.io/subdomain"
+)
+
+// SanitizePolicy tells how the fields of the original pod are carried into its copy.
+// A field is given by its path in the JSON representation of the pod, e.g. "spec.hostname";
+// a map key containing dots is quoted by brackets, e.g. "metadata.annotations[pod.beta.kubernetes.io/hostname]",
+// and so is the index of a list element, e.g. "spec.containers[0].image".
+type SanitizePolicy struct {
+	//fields removed from the copy
+	Strip []string `json:"strip,omitempty"`
+
+	//fields kept in the copy, even if they are in Strip
+	Keep []string `json:"keep,omitempty"`
+
+	//fields set to the given values in the copy
+	Override map[string]interface{} `json:"override,omitempty"`
+
+	//remove the service account token volume, which is injected again when the copy is created
+	StripInjectedVolumes *bool `json:"stripInjectedVolumes,omitempty"`
+}
+
+// fields set by the apiserver, or bound to the original pod
+var defaultStripFields = []string{
+	"metadata.selfLink",
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.deletionTimestamp",
+	"metadata.deletionGracePeriodSeconds",
+	"spec.nodeName",
+	"status",
+}
+
+// fields of the pod's identity, which may conflict with the pods created by the parent
+var identityFields = []string{
+	"spec.hostname",
+	"spec.subdomain",
+}
+
+var identityFields15 = []string{
+	fmt.Sprintf("metadata.annotations[%v]", hostnameAnnotationKey),
+	fmt.Sprintf("metadata.annotations[%v]", subdomainAnnotationKey),
+}
+
+// the default policy: the pod identity is stripped, as the parents supported are ReplicationControllers and ReplicaSets,
+// whose pods do not depend on it.
+func DefaultSanitizePolicy(highver bool) *SanitizePolicy {
+	strip := append([]string{}, defaultStripFields...)
+	strip = append(strip, identityFields...)
+	if !highver {
+		strip = append(strip, identityFields15...)
+	}
+
+	stripInjected := true
+	return &SanitizePolicy{
+		Strip:                strip,
+		StripInjectedVolumes: &stripInjected,
+	}
+}
+
+// read the policy from a JSON file
+func LoadSanitizePolicy(fpath string) (*SanitizePolicy, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sanitize policy %v: %v", fpath, err)
+	}
+
+	policy := &SanitizePolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to decode sanitize policy %v: %v", fpath, err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sanitize policy %v: %v", fpath, err)
+	}
+	return policy, nil
+}
+
+// check the field paths of the policy
+func (p *SanitizePolicy) Validate() error {
+	paths := append(append([]string{}, p.Strip...), p.Keep...)
+	for path := range p.Override {
+		paths = append(paths, path)
+	}
+
+	for _, path := range paths {
+		if _, err := parseFieldPath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the policy with the rules of other added; other can be nil.
+func (p *SanitizePolicy) Merge(other *SanitizePolicy) *SanitizePolicy {
+	result := &SanitizePolicy{
+		Strip:                append([]string{}, p.Strip...),
+		Keep:                 append([]string{}, p.Keep...),
+		Override:             make(map[string]interface{}),
+		StripInjectedVolumes: p.StripInjectedVolumes,
+	}
+	for k, v := range p.Override {
+		result.Override[k] = v
+	}
+
+	if other == nil {
+		return result
+	}
+
+	result.Strip = append(result.Strip, other.Strip...)
+	result.Keep = append(result.Keep, other.Keep...)
+	for k, v := range other.Override {
+		result.Override[k] = v
+	}
+	if other.StripInjectedVolumes != nil {
+		result.StripInjectedVolumes = other.StripInjectedVolumes
+	}
+	return result
+}
+
+// make a copy of the pod according to the policy
+func (p *SanitizePolicy) Apply(pod *api.Pod) (*api.Pod, error) {
+	data, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool)
+	for _, path := range p.Keep {
+		keep[path] = true
+	}
+
+	for _, path := range p.Strip {
+		if keep[path] {
+			continue
+		}
+		segs, err := parseFieldPath(path)
+		if err != nil {
+			return nil, err
+		}
+		deleteField(obj, segs)
+	}
+
+	for path, value := range p.Override {
+		segs, err := parseFieldPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := setField(obj, segs, value); err != nil {
+			return nil, fmt.Errorf("failed to override %v: %v", path, err)
+		}
+	}
+
+	if data, err = json.Marshal(obj); err != nil {
+		return nil, err
+	}
+	npod := &api.Pod{}
+	if err := json.Unmarshal(data, npod); err != nil {
+		return nil, fmt.Errorf("the sanitized pod is invalid: %v", err)
+	}
+
+	if p.StripInjectedVolumes != nil && *p.StripInjectedVolumes {
+		stripServiceAccountToken(npod)
+	}
+	return npod, nil
+}
+
+// split the path into the keys, e.g. "metadata.annotations[a.b/c]" -> [metadata, annotations, a.b/c]
+func parseFieldPath(path string) ([]string, error) {
+	segs := []string{}
+	rest := path
+	for rest != "" {
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in field path: %v", path)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("empty key in field path: %v", path)
+			}
+			segs = append(segs, rest[1:end])
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+			continue
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("empty key in field path: %v", path)
+		}
+		segs = append(segs, rest[:end])
+		rest = rest[end:]
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("trailing dot in field path: %v", path)
+			}
+		}
+	}
+
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("empty field path")
+	}
+	return segs, nil
+}
+
+// the index of a list element given by seg
+func listIndex(list []interface{}, seg string) (int, error) {
+	idx, err := strconv.Atoi(seg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid list index: %v", seg)
+	}
+	if idx < 0 || idx >= len(list) {
+		return 0, fmt.Errorf("list index %d out of range %d", idx, len(list))
+	}
+	return idx, nil
+}
+
+// remove the field from the node, and return the node; a missing field is ignored.
+func deleteField(node interface{}, segs []string) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(segs) == 1 {
+			delete(n, segs[0])
+		} else if child, ok := n[segs[0]]; ok {
+			n[segs[0]] = deleteField(child, segs[1:])
+		}
+		return n
+	case []interface{}:
+		idx, err := listIndex(n, segs[0])
+		if err != nil {
+			return n
+		}
+		if len(segs) == 1 {
+			return append(n[:idx:idx], n[idx+1:]...)
+		}
+		n[idx] = deleteField(n[idx], segs[1:])
+		return n
+	}
+	return node
+}
+
+// set the field, creating the missing maps on the way; a list element must exist.
+func setField(obj map[string]interface{}, segs []string, value interface{}) error {
+	var node interface{} = obj
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if last {
+				n[seg] = value
+				return nil
+			}
+			if n[seg] == nil {
+				n[seg] = make(map[string]interface{})
+			}
+			node = n[seg]
+		case []interface{}:
+			idx, err := listIndex(n, seg)
+			if err != nil {
+				return err
+			}
+			if last {
+				n[idx] = value
+				return nil
+			}
+			node = n[idx]
+		default:
+			return fmt.Errorf("%v is neither a map nor a list", strings.Join(segs[:i], "."))
+		}
+	}
+	return nil
+}
+
+// remove the service account token volume and its mounts
+func stripServiceAccountToken(pod *api.Pod) {
+	volumes := []api.Volume{}
+	removed := make(map[string]bool)
+	for _, vol := range pod.Spec.Volumes {
+		if vol.Secret != nil && isServiceAccountTokenVolume(pod, vol.Name) {
+			removed[vol.Name] = true
+			continue
+		}
+		volumes = append(volumes, vol)
+	}
+	if len(removed) == 0 {
+		return
+	}
+	pod.Spec.Volumes = volumes
+
+	strip := func(containers []api.Container) {
+		for i := range containers {
+			mounts := []api.VolumeMount{}
+			for _, m := range containers[i].VolumeMounts {
+				if !removed[m.Name] {
+					mounts = append(mounts, m)
+				}
+			}
+			containers[i].VolumeMounts = mounts
+		}
+	}
+	strip(pod.Spec.InitContainers)
+	strip(pod.Spec.Containers)
+}
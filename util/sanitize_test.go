@@ -0,0 +1,301 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "status", want: []string{"status"}},
+		{path: "spec.nodeName", want: []string{"spec", "nodeName"}},
+		{path: "metadata.annotations[a.b/c]", want: []string{"metadata", "annotations", "a.b/c"}},
+		{path: "metadata.annotations[a.b/c].x", want: []string{"metadata", "annotations", "a.b/c", "x"}},
+		{path: "spec.containers[0].image", want: []string{"spec", "containers", "0", "image"}},
+		{path: "spec.containers[1][2]", want: []string{"spec", "containers", "1", "2"}},
+		{path: "", wantErr: true},
+		{path: ".spec", wantErr: true},
+		{path: "spec..nodeName", wantErr: true},
+		{path: "spec.", wantErr: true},
+		{path: "metadata.annotations[a.b", wantErr: true},
+		{path: "metadata.annotations[]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFieldPath(tt.path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseFieldPath(%q): expected an error, got %v", tt.path, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFieldPath(%q): unexpected error: %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFieldPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// decode a JSON document as the generic form the policy is applied on
+func decodeObject(t *testing.T, data string) map[string]interface{} {
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatalf("invalid JSON %v: %v", data, err)
+	}
+	return obj
+}
+
+func TestDeleteField(t *testing.T) {
+	const doc = `{"metadata": {"name": "p", "annotations": {"a.b/c": "1", "d": "2"}},
+		"spec": {"containers": [{"name": "c0", "image": "i0"}, {"name": "c1", "image": "i1"}]}}`
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "nested map",
+			path: "metadata.annotations[a.b/c]",
+			want: `{"metadata": {"name": "p", "annotations": {"d": "2"}},
+				"spec": {"containers": [{"name": "c0", "image": "i0"}, {"name": "c1", "image": "i1"}]}}`,
+		},
+		{
+			name: "field of a list element",
+			path: "spec.containers[1].image",
+			want: `{"metadata": {"name": "p", "annotations": {"a.b/c": "1", "d": "2"}},
+				"spec": {"containers": [{"name": "c0", "image": "i0"}, {"name": "c1"}]}}`,
+		},
+		{
+			name: "list element",
+			path: "spec.containers[0]",
+			want: `{"metadata": {"name": "p", "annotations": {"a.b/c": "1", "d": "2"}},
+				"spec": {"containers": [{"name": "c1", "image": "i1"}]}}`,
+		},
+		{
+			name: "missing key",
+			path: "metadata.labels.app",
+			want: doc,
+		},
+		{
+			name: "index out of range",
+			path: "spec.containers[2].image",
+			want: doc,
+		},
+		{
+			name: "index of a map",
+			path: "metadata[0]",
+			want: doc,
+		},
+	}
+
+	for _, tt := range tests {
+		segs, err := parseFieldPath(tt.path)
+		if err != nil {
+			t.Fatalf("%v: invalid path %v: %v", tt.name, tt.path, err)
+		}
+		obj := decodeObject(t, doc)
+		deleteField(obj, segs)
+		if want := decodeObject(t, tt.want); !reflect.DeepEqual(obj, want) {
+			t.Errorf("%v: deleting %v got %v, want %v", tt.name, tt.path, obj, want)
+		}
+	}
+}
+
+func TestSetField(t *testing.T) {
+	const doc = `{"metadata": {"name": "p"}, "spec": {"containers": [{"name": "c0"}]}}`
+
+	tests := []struct {
+		name    string
+		path    string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "missing maps are created",
+			path:  "metadata.labels[moved.by]",
+			value: "movepod",
+			want:  `{"metadata": {"name": "p", "labels": {"moved.by": "movepod"}}, "spec": {"containers": [{"name": "c0"}]}}`,
+		},
+		{
+			name:  "field of a list element",
+			path:  "spec.containers[0].image",
+			value: "nginx",
+			want:  `{"metadata": {"name": "p"}, "spec": {"containers": [{"name": "c0", "image": "nginx"}]}}`,
+		},
+		{
+			name:    "index out of range",
+			path:    "spec.containers[1].image",
+			value:   "nginx",
+			wantErr: true,
+		},
+		{
+			name:    "not a list index",
+			path:    "spec.containers[first].image",
+			value:   "nginx",
+			wantErr: true,
+		},
+		{
+			name:    "below a scalar",
+			path:    "spec.containers[0].name.first",
+			value:   "c",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		segs, err := parseFieldPath(tt.path)
+		if err != nil {
+			t.Fatalf("%v: invalid path %v: %v", tt.name, tt.path, err)
+		}
+		obj := decodeObject(t, doc)
+		err = setField(obj, segs, tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected an error setting %v, got %v", tt.name, tt.path, obj)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error setting %v: %v", tt.name, tt.path, err)
+			continue
+		}
+		if want := decodeObject(t, tt.want); !reflect.DeepEqual(obj, want) {
+			t.Errorf("%v: setting %v got %v, want %v", tt.name, tt.path, obj, want)
+		}
+	}
+}
+
+func TestSanitizePolicyApply(t *testing.T) {
+	grace := int64(30)
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-1",
+			Namespace:       "default",
+			UID:             "uid-1",
+			ResourceVersion: "100",
+			Labels:          map[string]string{"app": "web"},
+			Annotations:     map[string]string{hostnameAnnotationKey: "web-1", "example.com/owner": "team"},
+		},
+		Spec: api.PodSpec{
+			NodeName:                      "node-1",
+			Hostname:                      "web-1",
+			TerminationGracePeriodSeconds: &grace,
+			Containers:                    []api.Container{{Name: "app", Image: "nginx:1.12"}},
+		},
+		Status: api.PodStatus{Phase: api.PodRunning},
+	}
+
+	tests := []struct {
+		name    string
+		policy  *SanitizePolicy
+		check   func(npod *api.Pod) string
+		wantErr bool
+	}{
+		{
+			name:   "default strips the fields of the apiserver and the identity",
+			policy: DefaultSanitizePolicy(false),
+			check: func(npod *api.Pod) string {
+				if npod.UID != "" || npod.ResourceVersion != "" || npod.Spec.NodeName != "" || npod.Status.Phase != "" {
+					return "the fields set by the apiserver are kept"
+				}
+				if npod.Spec.Hostname != "" {
+					return "spec.hostname is kept"
+				}
+				if _, ok := npod.Annotations[hostnameAnnotationKey]; ok {
+					return "the hostname annotation is kept"
+				}
+				if npod.Name != "web-1" || npod.Labels["app"] != "web" || npod.Annotations["example.com/owner"] != "team" {
+					return "the other fields are not kept"
+				}
+				return ""
+			},
+		},
+		{
+			name: "keep overrides strip",
+			policy: DefaultSanitizePolicy(true).Merge(&SanitizePolicy{
+				Strip: []string{"metadata.annotations[example.com/owner]"},
+				Keep:  []string{"spec.hostname"},
+			}),
+			check: func(npod *api.Pod) string {
+				if npod.Spec.Hostname != "web-1" {
+					return "spec.hostname is stripped"
+				}
+				if _, ok := npod.Annotations["example.com/owner"]; ok {
+					return "the stripped annotation is kept"
+				}
+				return ""
+			},
+		},
+		{
+			name: "override of a nested map and a list element",
+			policy: &SanitizePolicy{Override: map[string]interface{}{
+				"metadata.labels.moved":    "true",
+				"spec.containers[0].image": "nginx:1.13",
+			}},
+			check: func(npod *api.Pod) string {
+				if npod.Labels["moved"] != "true" || npod.Labels["app"] != "web" {
+					return "the labels are not overridden"
+				}
+				if npod.Spec.Containers[0].Image != "nginx:1.13" {
+					return "the image is not overridden"
+				}
+				return ""
+			},
+		},
+		{
+			name:   "missing paths are ignored",
+			policy: &SanitizePolicy{Strip: []string{"spec.affinity.nodeAffinity", "spec.containers[3].image"}},
+			check: func(npod *api.Pod) string {
+				if !reflect.DeepEqual(npod.Spec, pod.Spec) {
+					return "the spec is changed"
+				}
+				return ""
+			},
+		},
+		{
+			name:    "bad syntax",
+			policy:  &SanitizePolicy{Strip: []string{"metadata.annotations[a.b"}},
+			wantErr: true,
+		},
+		{
+			name:    "override of a missing list element",
+			policy:  &SanitizePolicy{Override: map[string]interface{}{"spec.containers[1].image": "nginx"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		npod, err := tt.policy.Apply(pod)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if msg := tt.check(npod); msg != "" {
+			t.Errorf("%v: %v", tt.name, msg)
+		}
+	}
+
+	//the original pod is not changed
+	if pod.Spec.NodeName != "node-1" || pod.UID != "uid-1" || pod.Labels["moved"] != "" {
+		t.Errorf("the original pod is changed: %+v", pod)
+	}
+}
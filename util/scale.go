@@ -0,0 +1,282 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kclient "k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// how long to wait for the parent to delete the original pod after scaling down
+	scaleDownTimeout = time.Second * 30
+)
+
+// set the replicas of the parent by the scale subresource; return the previous replicas
+func scaleParent(client *kclient.Clientset, nameSpace, kind, name string, delta int32) (int32, error) {
+	scales := client.ExtensionsV1beta1().Scales(nameSpace)
+
+	var previous int32
+	err := RetryDuring(defaultRetryLess, defaultTimeOut, defaultSleep, func() error {
+		scale, err := scales.Get(kind, name)
+		if err != nil {
+			return err
+		}
+
+		previous = scale.Spec.Replicas
+		scale.Spec.Replicas = previous + delta
+		_, err = scales.Update(kind, scale)
+		return err
+	})
+
+	return previous, err
+}
+
+// check that the replicas of the parent can be scaled by the move: the replicas of a ReplicaSet owned by a Deployment
+// are reset by the Deployment controller, which would delete the copy, or bring back a pod after the scale down.
+func CheckScaleParent(client *kclient.Clientset, nameSpace, parentKind, parentName string) error {
+	if parentKind != kindReplicaSet {
+		return nil
+	}
+
+	deploy, _, err := GetReplicaSetDeployment(client, nameSpace, parentName)
+	if err != nil {
+		return NewMoveError(ReasonInvalidParent, "move-aborted: cannot get Deployment of ReplicaSet %v/%v: %v", nameSpace, parentName, err)
+	}
+	if deploy != nil {
+		return NewMoveError(ReasonUnsupportedParent,
+			"move-aborted: ReplicaSet %v/%v is owned by Deployment %v, which resets its replicas; use strategy %v or %v instead",
+			nameSpace, parentName, deploy.Name, StrategySchedulerSwap, StrategyOrphan)
+	}
+	return nil
+}
+
+// move the pod by the replicas of the parent:
+// scale up by one, create the copy on nodeName as the new replica,
+// then scale down, so that the parent deletes a pod by the ordering of its ActivePods.
+// The scheduler of the parent should have been swapped, so the replica created by the parent itself is not scheduled.
+// Return the new pod.
+func ScaleMovePod(client *kclient.Clientset, pod *api.Pod, parentKind, parentName, nodeName string, opts *MoveOptions) (*api.Pod, error) {
+	id := fmt.Sprintf("%v/%v", pod.Namespace, pod.Name)
+
+	npod, err := ClonePodForMove(pod, nodeName, opts.Policy)
+	if err != nil {
+		return nil, NewMoveError(ReasonInvalidInput, "move-aborted: failed to copy pod-%v: %v", id, err)
+	}
+	if err := opts.Mutation.Apply(npod); err != nil {
+		return nil, NewMoveError(ReasonInvalidInput, "move-aborted: failed to mutate the copy of pod-%v: %v", id, err)
+	}
+	//the copy is an additional replica, so it cannot take the name of the original pod
+	useGeneratedName(pod, npod)
+
+	if opts.IsCancelled() {
+		return nil, NewMoveError(ReasonCancelled, "move-aborted: move of pod-%v is cancelled", id)
+	}
+
+	//1. scale up
+	t0 := time.Now()
+	replicas, err := scaleParent(client, pod.Namespace, parentKind, parentName, 1)
+	opts.Trace.AddPhase(PhaseScaleUp, t0, err)
+	if err != nil {
+		merr := NewMoveError(ReasonScaleFailed, "move-aborted: failed to scale up %v %v: %v", parentKind, parentName, err)
+		glog.Error(merr)
+		return nil, merr
+	}
+	glog.V(2).Infof("scaled %v %v/%v from %d to %d replicas", parentKind, pod.Namespace, parentName, replicas, replicas+1)
+
+	//scale back; the pod the parent deletes is the copy if it is not ready, or the one chosen by the ActivePods ordering.
+	scaleBack := func() {
+		if _, err := scaleParent(client, pod.Namespace, parentKind, parentName, -1); err != nil {
+			glog.Errorf("failed to scale %v %v/%v back to %d replicas: %v", parentKind, pod.Namespace, parentName, replicas, err)
+			return
+		}
+		opts.Trace.AddCleanup(fmt.Sprintf("scaled %v %v/%v back to %d replicas", parentKind, pod.Namespace, parentName, replicas))
+	}
+
+	//2. create the copy as the new replica
+	t0 = time.Now()
+	var created *api.Pod
+	err = RetryDuring(opts.RetryNum, defaultTimeOut*time.Duration(opts.RetryNum), defaultSleep, func() error {
+		var inerr error
+		created, inerr = CreatePodCopy(client, npod, pod.Spec.NodeName, opts)
+		return inerr
+	})
+	opts.Trace.AddPhase(PhaseCreate, t0, err)
+	if err != nil {
+		scaleBack()
+		merr := NewMoveError(ReasonCreateFailed, "move-failed: failed to create copy of pod-%v: %v", id, err)
+		glog.Error(merr)
+		return nil, merr
+	}
+
+	t0 = time.Now()
+	_, err = WaitPodMoveHealth(client, pod.Namespace, created.Name, nodeName, orphanReadyTimeout)
+	opts.Trace.AddPhase(PhaseReady, t0, err)
+	if err != nil {
+		scaleBack()
+		merr := NewMoveError(ReasonHealthCheckFailed, "move-failed: copy %v/%v of pod-%v is not running: %v",
+			pod.Namespace, created.Name, id, err)
+		glog.Error(merr)
+		return created, merr
+	}
+
+	//3. scale down
+	t0 = time.Now()
+	err = scaleDownOriginal(client, pod, parentKind, parentName, nodeName, opts)
+	opts.Trace.AddPhase(PhaseScaleDown, t0, err)
+	if err != nil {
+		return created, err
+	}
+
+	glog.V(2).Infof("move-finished: %v from %v to %v, replaced by %v", id, pod.Spec.NodeName, nodeName, created.Name)
+	return created, nil
+}
+
+// scale down the parent, so that it deletes the original pod.
+// If the ActivePods ordering would not choose the original pod, it is deleted first:
+// then the replica created by the parent meanwhile is unassigned (the scheduler is swapped), so it is chosen instead.
+func scaleDownOriginal(client *kclient.Clientset, pod *api.Pod, parentKind, parentName, nodeName string, opts *MoveOptions) error {
+	id := fmt.Sprintf("%v/%v", pod.Namespace, pod.Name)
+
+	var changed error
+	victim, err := predictScaleDownVictim(client, pod.Namespace, parentKind, parentName)
+	if err != nil {
+		glog.Warningf("failed to predict the pod to be deleted by %v %v: %v", parentKind, parentName, err)
+	}
+	if victim == nil || victim.UID != pod.UID {
+		if victim != nil {
+			glog.V(2).Infof("%v %v would delete pod %v instead of %v on scaling down; delete %v first",
+				parentKind, parentName, victim.Name, pod.Name, pod.Name)
+		}
+		if err := DeleteOriginalPod(client, pod, nodeName, opts); err != nil {
+			if ReasonForError(err) != ReasonPodChanged {
+				return err
+			}
+			//the original is gone anyway; still scale down, so that the parent is back to its replicas
+			changed = err
+		}
+	}
+
+	if _, err := scaleParent(client, pod.Namespace, parentKind, parentName, -1); err != nil {
+		merr := NewMoveError(ReasonScaleFailed, "move-failed: failed to scale down %v %v: %v", parentKind, parentName, err)
+		glog.Error(merr)
+		return merr
+	}
+	if changed != nil {
+		return changed
+	}
+
+	//wait for the original pod to go away
+	err = wait.Poll(orphanPollInterval, scaleDownTimeout, func() (bool, error) {
+		current, err := client.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return errors.IsNotFound(err), nil
+		}
+		return current.UID != pod.UID || current.DeletionTimestamp != nil, nil
+	})
+	if err != nil {
+		merr := NewMoveError(ReasonScaleFailed, "move-failed: pod-%v is not deleted by %v %v after scaling down", id, parentKind, parentName)
+		glog.Error(merr)
+		return merr
+	}
+	return nil
+}
+
+// the pod which the parent would delete first when scaling down
+func predictScaleDownVictim(client *kclient.Clientset, nameSpace, parentKind, parentName string) (*api.Pod, error) {
+	selector, _, err := getParentSelector(client, nameSpace, parentKind, parentName)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := client.CoreV1().Pods(nameSpace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	var victim *api.Pod
+	for i := range pods.Items {
+		pod := &(pods.Items[i])
+		if !isActivePod(pod) {
+			continue
+		}
+		if victim == nil || activePodLess(pod, victim) {
+			victim = pod
+		}
+	}
+	return victim, nil
+}
+
+//---------- the ordering of controller.ActivePods (k8s 1.7) ----------
+
+func isActivePod(pod *api.Pod) bool {
+	return pod.Status.Phase != api.PodSucceeded && pod.Status.Phase != api.PodFailed && pod.DeletionTimestamp == nil
+}
+
+func isPodReady(pod *api.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == api.PodReady {
+			return c.Status == api.ConditionTrue
+		}
+	}
+	return false
+}
+
+func podReadyTime(pod *api.Pod) metav1.Time {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == api.PodReady && c.Status == api.ConditionTrue {
+			return c.LastTransitionTime
+		}
+	}
+	return metav1.Time{}
+}
+
+func maxContainerRestarts(pod *api.Pod) int32 {
+	var result int32
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.RestartCount > result {
+			result = c.RestartCount
+		}
+	}
+	return result
+}
+
+// whether a is deleted before b
+func activePodLess(a, b *api.Pod) bool {
+	// 1. Unassigned < assigned
+	if a.Spec.NodeName != b.Spec.NodeName && (len(a.Spec.NodeName) == 0 || len(b.Spec.NodeName) == 0) {
+		return len(a.Spec.NodeName) == 0
+	}
+	// 2. PodPending < PodUnknown < PodRunning
+	m := map[api.PodPhase]int{api.PodPending: 0, api.PodUnknown: 1, api.PodRunning: 2}
+	if m[a.Status.Phase] != m[b.Status.Phase] {
+		return m[a.Status.Phase] < m[b.Status.Phase]
+	}
+	// 3. Not ready < ready
+	if isPodReady(a) != isPodReady(b) {
+		return !isPodReady(a)
+	}
+	// 4. Been ready for empty time < less time < more time
+	if isPodReady(a) && isPodReady(b) {
+		ta, tb := podReadyTime(a).Time, podReadyTime(b).Time
+		if !ta.Equal(tb) {
+			return ta.IsZero() || (!tb.IsZero() && tb.Before(ta))
+		}
+	}
+	// 5. Pods with containers with higher restart counts < lower restart counts
+	if maxContainerRestarts(a) != maxContainerRestarts(b) {
+		return maxContainerRestarts(a) > maxContainerRestarts(b)
+	}
+	// 6. Empty creation time pods < newer pods < older pods
+	ca, cb := a.CreationTimestamp.Time, b.CreationTimestamp.Time
+	if !ca.Equal(cb) {
+		return ca.IsZero() || (!cb.IsZero() && cb.Before(ca))
+	}
+	return false
+}
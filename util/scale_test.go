@@ -0,0 +1,147 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	api "k8s.io/client-go/pkg/api/v1"
+)
+
+// a pod for the ActivePods ordering; readySince is zero for a pod which is not ready
+type podState struct {
+	node       string
+	phase      api.PodPhase
+	ready      bool
+	readySince time.Time
+	restarts   int32
+	created    time.Time
+}
+
+func newOrderingPod(s podState) *api.Pod {
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(s.created)},
+		Spec:       api.PodSpec{NodeName: s.node},
+		Status: api.PodStatus{
+			Phase:             s.phase,
+			ContainerStatuses: []api.ContainerStatus{{RestartCount: s.restarts}},
+		},
+	}
+	if s.ready {
+		pod.Status.Conditions = []api.PodCondition{{
+			Type:               api.PodReady,
+			Status:             api.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(s.readySince),
+		}}
+	}
+	return pod
+}
+
+func TestActivePodLess(t *testing.T) {
+	now := time.Now()
+	older := now.Add(-time.Hour)
+
+	running := podState{node: "n1", phase: api.PodRunning, ready: true, readySince: older, created: older}
+	with := func(f func(s *podState)) podState {
+		s := running
+		f(&s)
+		return s
+	}
+
+	tests := []struct {
+		name string
+		a, b podState
+		want bool
+	}{
+		{
+			name: "unassigned before assigned",
+			a:    with(func(s *podState) { s.node = "" }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "assigned after unassigned",
+			a:    running,
+			b:    with(func(s *podState) { s.node = "" }),
+			want: false,
+		},
+		{
+			name: "different nodes are not ordered by node",
+			a:    running,
+			b:    with(func(s *podState) { s.node = "n2" }),
+			want: false,
+		},
+		{
+			name: "pending before running",
+			a:    with(func(s *podState) { s.phase = api.PodPending; s.ready = false }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "unknown before running",
+			a:    with(func(s *podState) { s.phase = api.PodUnknown }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "pending before unknown",
+			a:    with(func(s *podState) { s.phase = api.PodPending }),
+			b:    with(func(s *podState) { s.phase = api.PodUnknown }),
+			want: true,
+		},
+		{
+			name: "not ready before ready",
+			a:    with(func(s *podState) { s.ready = false }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "ready for less time before more time",
+			a:    with(func(s *podState) { s.readySince = now }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "ready for more time after less time",
+			a:    running,
+			b:    with(func(s *podState) { s.readySince = now }),
+			want: false,
+		},
+		{
+			name: "empty ready time first",
+			a:    with(func(s *podState) { s.readySince = time.Time{} }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "more restarts before fewer",
+			a:    with(func(s *podState) { s.restarts = 3 }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "newer before older",
+			a:    with(func(s *podState) { s.created = now }),
+			b:    running,
+			want: true,
+		},
+		{
+			name: "older after newer",
+			a:    running,
+			b:    with(func(s *podState) { s.created = now }),
+			want: false,
+		},
+		{
+			name: "equal pods are not ordered",
+			a:    running,
+			b:    running,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := activePodLess(newOrderingPod(tt.a), newOrderingPod(tt.b)); got != tt.want {
+			t.Errorf("%v: activePodLess = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
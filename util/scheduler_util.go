@@ -266,3 +266,10 @@ func ParsePodSchedulerName(pod *api.Pod, highver bool) string {
 	return ""
 }
 
+// describe where the scheduler of the pod template is read and written
+func SchedulerAccessor(highver bool) string {
+	if highver {
+		return "field spec.template.spec.schedulerName"
+	}
+	return fmt.Sprintf("annotation %v of spec.template", schedulerAnnotationKey)
+}
@@ -0,0 +1,201 @@
+package util
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// phases of a move
+const (
+	PhaseSchedulerSwap    = "schedulerSwap"
+	PhaseDelete           = "delete"
+	PhaseCreate           = "create"
+	PhaseReady            = "ready"
+	PhaseSchedulerRestore = "schedulerRestore"
+	PhaseOrphan           = "orphan"
+	PhaseScaleUp          = "scaleUp"
+	PhaseScaleDown        = "scaleDown"
+)
+
+// move strategies
+const (
+	StrategyDirect        = "direct"
+	StrategySchedulerSwap = "schedulerSwap"
+	StrategyOrphan        = "orphan"
+	StrategyScale         = "scale"
+)
+
+// final status of a move
+const (
+	StatusRunning   = "Running"
+	StatusSucceeded = "Succeeded"
+	StatusFailed    = "Failed"
+)
+
+type PhaseTiming struct {
+	Name       string    `json:"name"`
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"durationMs"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// MoveResult is the result of a move.
+type MoveResult struct {
+	Pod             string        `json:"pod"`
+	SourceNode      string        `json:"sourceNode"`
+	DestinationNode string        `json:"destinationNode"`
+	NewPod          string        `json:"newPod,omitempty"`
+	ParentKind      string        `json:"parentKind,omitempty"`
+	ParentName      string        `json:"parentName,omitempty"`
+	Strategy        string        `json:"strategy,omitempty"`
+	GracePeriod     *GracePeriod  `json:"gracePeriod,omitempty"`
+	Phases          []PhaseTiming `json:"phases"`
+	Status          string        `json:"status"`
+	Reason          ErrorReason   `json:"reason,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	Cleanup         []string      `json:"cleanup,omitempty"`
+}
+
+// MoveTrace records what happened during a move.
+// All the methods are safe to be called on a nil MoveTrace, and from different goroutines.
+type MoveTrace struct {
+	lock   sync.Mutex
+	result MoveResult
+}
+
+func NewMoveTrace(pod, destNode string) *MoveTrace {
+	return &MoveTrace{
+		result: MoveResult{
+			Pod:             pod,
+			DestinationNode: destNode,
+			Phases:          []PhaseTiming{},
+			Status:          StatusRunning,
+		},
+	}
+}
+
+func (t *MoveTrace) SetDestination(node string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.DestinationNode = node
+}
+
+// the name of the pod which replaces the moved one, if it is different
+func (t *MoveTrace) SetNewPod(name string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.NewPod = name
+}
+
+func (t *MoveTrace) SetSource(node string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.SourceNode = node
+}
+
+func (t *MoveTrace) SetParent(kind, name string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.ParentKind = kind
+	t.result.ParentName = name
+}
+
+func (t *MoveTrace) SetStrategy(strategy string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.Strategy = strategy
+}
+
+// the grace period the original pod is deleted with
+func (t *MoveTrace) SetGracePeriod(grace *GracePeriod) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.GracePeriod = grace
+}
+
+// record a phase which began at start, and ends now.
+func (t *MoveTrace) AddPhase(name string, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+
+	p := PhaseTiming{
+		Name:       name,
+		Start:      start,
+		DurationMs: int64(time.Since(start) / time.Millisecond),
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.Phases = append(t.result.Phases, p)
+}
+
+// record a cleanup action, such as deleting a pending pod, or restoring a scheduler.
+func (t *MoveTrace) AddCleanup(action string) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.Cleanup = append(t.result.Cleanup, action)
+}
+
+// set the final status according to the error of the move.
+func (t *MoveTrace) Finish(err error) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err == nil {
+		t.result.Status = StatusSucceeded
+		return
+	}
+
+	t.result.Status = StatusFailed
+	t.result.Reason = ReasonForError(err)
+	t.result.Error = err.Error()
+}
+
+// get a copy of the current result
+func (t *MoveTrace) Result() MoveResult {
+	if t == nil {
+		return MoveResult{}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	r := t.result
+	r.Phases = append([]PhaseTiming{}, t.result.Phases...)
+	if len(t.result.Cleanup) > 0 {
+		r.Cleanup = append([]string{}, t.result.Cleanup...)
+	}
+	return r
+}
+
+func (t *MoveTrace) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Result())
+}